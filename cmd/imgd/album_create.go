@@ -23,6 +23,12 @@ func albumCreate(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	policy := state.PrivacyStripAll
+	if c.String("privacy") != "" {
+		if policy, err = state.ParsePrivacyPolicy(c.String("privacy")); err != nil {
+			return fmtErr(errCodeMisc, err)
+		}
+	}
 	var album state.Album
 	exitCode := func() cli.ExitCoder {
 		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
@@ -31,6 +37,8 @@ func albumCreate(c *cli.Context) error {
 		album = state.NewAlbum()
 		album.Name = c.String("title")
 		album.Description = c.String("description")
+		album.Privacy = policy
+		album.PrivateOriginals = c.Bool("private-originals")
 		st = st.AddAlbum(album)
 		if _, err := saveState(ctx, client, st); err != nil {
 			return err
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+func albumEdit(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	album := st.GetAlbum(c.Args().Get(0))
+	if album == nil {
+		return fmtErr(errCodeMisc, errors.New("Album does not exist"))
+	}
+	if c.String("title") != "" {
+		album.Name = c.String("title")
+	}
+	if c.IsSet("description") {
+		album.Description = c.String("description")
+	}
+	if c.IsSet("cover") {
+		if c.String("cover") != "" && !album.HasPhoto(c.String("cover")) {
+			return fmtErr(errCodeMisc, errors.New("Photo is not part of the album"))
+		}
+		album.Cover = c.String("cover")
+	}
+	if c.IsSet("unlisted") {
+		album.Unlisted = c.Bool("unlisted")
+	}
+	if c.IsSet("page-size") {
+		if c.Int("page-size") < 0 {
+			return fmtErr(errCodeMisc, errors.New("The page size can not be negative"))
+		}
+		album.PageSize = c.Int("page-size")
+	}
+	if c.IsSet("theme") {
+		if c.String("theme") != "" {
+			if _, err := gallery.LoadTheme(c.String("templates-dir"), c.String("theme")); err != nil {
+				return fmtErr(errCodeMisc, err)
+			}
+		}
+		album.Theme = c.String("theme")
+	}
+	if album.ThemeSettings, err = state.ApplyThemeSettings(album.ThemeSettings, c.StringSlice("setting")); err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st = st.UpdateAlbum(*album).TouchAlbum(*album)
+	album = st.GetAlbum(album.ID)
+	var errs []error
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		st, errs = gallery.CreateTemplatesFromState(ctx, client, st, *album, c.String("templates-dir"), "", c.Bool("force-render"))
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error while regenerating html files: %s", err)
+	}
+	if exitCode == nil {
+		prettyLog("%s has been updated", album.Name)
+	}
+	return exitCode
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/psaia/imgd/internal/state"
 	"github.com/urfave/cli/v2"
 )
 
@@ -31,7 +30,7 @@ func albumExpand(c *cli.Context) error {
 	for _, hash := range album.Photos {
 		photo := st.GetPhoto(hash)
 		if photo != nil {
-			fmt.Println(prettyLogStr("Name: %s\nID: %s\nURL: %s\n", photo.Name, photo.Hash, photo.PublicURL(client.GetLakeBaseURL(), *album, state.PhotoSizeTypeLarge)))
+			fmt.Println(prettyLogStr("Name: %s\nID: %s\nURL: %s\n", photo.Name, photo.Hash, photo.PublicURL(client.GetLakeBaseURL(), *album, album.PhotoLinkSize())))
 		}
 	}
 	return nil
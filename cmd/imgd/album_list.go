@@ -27,7 +27,11 @@ func albumList(c *cli.Context) error {
 	}
 	prettyLog("All albums:")
 	for i, a := range st.Albums {
-		fmt.Printf(prettyLogStr("%d. %s  %s  [%d photos]  %s", i+1, a.ID, a.Name, len(a.Photos), a.PublicURL(client.GetLakeBaseURL())))
+		unlisted := ""
+		if a.Unlisted {
+			unlisted = "  (unlisted)"
+		}
+		fmt.Printf(prettyLogStr("%d. %s  %s  [%d photos]  %s%s", i+1, a.ID, a.Name, len(a.Photos), a.PublicURL(client.GetLakeBaseURL()), unlisted))
 	}
 	return nil
 }
@@ -4,24 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/briandowns/spinner"
-	"github.com/manifoldco/promptui"
-	"github.com/psaia/imgd/internal/gallery"
-	"github.com/psaia/imgd/internal/provider"
 	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/sync/semaphore"
 )
 
-// albumRemoveJob represents a media item which will be added or removed.
-type albumRemoveJob struct {
-	size  state.PhotoSizeType
-	photo state.Photo
-}
-
 func albumRemove(c *cli.Context) error {
 	ctx := context.Background()
 	p, err := getProvider(c.String("provider"))
@@ -32,31 +22,31 @@ func albumRemove(c *cli.Context) error {
 	if err != nil {
 		return fmtErr(errCodeMisc, err)
 	}
-	st, err := provisionState(ctx, client)
-	if err != nil {
-		return err
+	w, exitErr := openWorkspace(ctx, client)
+	if exitErr != nil {
+		return exitErr
 	}
-	album := st.GetAlbum(c.Args().Get(0))
+	album := w.State.GetAlbum(c.Args().Get(0))
 	if album == nil {
 		return fmtErr(errCodeMisc, errors.New("Album does not exist"))
 	}
-	jobs := albumRemoveJobs(st, *album)
-	if !albumRemovePrompt(jobs) {
-		return fmtErr(errCodeNoop, nil)
+	tplDir, theme, err := themeFromFlags(c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	if err := albumRemovePrompt(c, w.State, *album); err != nil {
+		return err
 	}
 	var errs []error
 	exitCode := func() cli.ExitCoder {
 		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 		s.Start()
 		defer s.Stop()
-		st, errs = albumRemoveRun(ctx, *album, st, client, jobs)
-		album = st.GetAlbum(album.ID)
-		if len(album.Photos) == 0 {
-			st = st.RemoveAlbum(*album)
-		} else {
+		errs = w.RemoveAlbum(ctx, album.ID, imgd.RenderOptions{TplDir: tplDir, Theme: theme})
+		if w.State.GetAlbum(album.ID) != nil {
 			return fmtErr(errCodeMisc, errors.New("Could not fully remove album because there were issues removing some of the photos within it. Please try again"))
 		}
-		if _, err := saveState(ctx, client, st); err != nil {
+		if _, err := saveState(ctx, client, w.State); err != nil {
 			return err
 		}
 		return nil
@@ -70,88 +60,16 @@ func albumRemove(c *cli.Context) error {
 	return exitCode
 }
 
-func albumRemoveJobs(st state.State, album state.Album) []albumRemoveJob {
-	jobs := make([]albumRemoveJob, 0)
+func albumRemovePrompt(c *cli.Context, st state.State, album state.Album) cli.ExitCoder {
+	var removeList string
 	for _, hash := range album.Photos {
-		photo := st.GetPhoto(hash)
-		if photo != nil {
-			for _, size := range state.GetPhotoSizeTypes() {
-				jobs = append(jobs, albumRemoveJob{
-					size:  size,
-					photo: *photo,
-				})
-			}
+		if photo := st.GetPhoto(hash); photo != nil {
+			removeList = fmt.Sprintf("%s- %s [%s]\n", removeList, photo.Hash, photo.Name)
 		}
 	}
-	return jobs
-}
-
-func albumRemovePrompt(forRemoval []albumRemoveJob) bool {
-	var removeList string
-	if len(forRemoval) > 0 {
-		for _, job := range forRemoval {
-			if job.size == state.PhotoSizeTypeOriginal {
-				removeList = fmt.Sprintf("%s- %s [%s]\n", removeList, job.photo.Hash, job.photo.Name)
-			}
-		}
-	} else {
+	if removeList == "" {
 		removeList = "Nothing to remove."
 	}
 	prettyLog("Removing:\n%s\n", removeList)
-	prompt := promptui.Prompt{
-		Label:     fmt.Sprintf("Are you sure you would like to proceed"),
-		IsConfirm: true,
-	}
-	str, _ := prompt.Run()
-	return str == "y"
-}
-
-func albumRemoveRun(ctx context.Context, album state.Album, st state.State, client provider.Client, jobs []albumRemoveJob) (state.State, []error) {
-	var mu sync.Mutex
-	errors := make([]error, 0)
-	maxWorkers := 20
-	sem := semaphore.NewWeighted(int64(maxWorkers))
-
-	for _, job := range jobs {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			prettyDebug("Failed to acquire semaphore: %v", err)
-			break
-		}
-		go func(j albumRemoveJob) {
-			defer sem.Release(1)
-			if err := client.RemoveFile(ctx, j.photo.RawFilename(j.size)); err != nil && err != provider.ErrNotExist {
-				mu.Lock()
-				errors = append(errors, err)
-				mu.Unlock()
-				return
-			}
-			if err := client.RemoveFile(ctx, j.photo.PublicSlug(album, j.size)); err != nil {
-				mu.Lock()
-				errors = append(errors, err)
-				mu.Unlock()
-			}
-			if j.size == state.PhotoSizeTypeOriginal {
-				mu.Lock()
-				st = st.RemovePhotoFromAlbum(album, j.photo)
-				st = st.RemovePhotoSafe(j.photo)
-				mu.Unlock()
-			}
-		}(job)
-	}
-	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
-		prettyDebug("Failed to acquire semaphore: %v", err)
-	}
-	if err := client.RemoveFile(ctx, album.PublicSlug()); err != nil {
-		errors = append(errors, err)
-	}
-	// Regenerate the index file.
-	if err := gallery.CreateIndexTemplate(ctx, gallery.CreateIndexOptions{
-		ThemeName: "",
-		TplDir:    "",
-		Client:    client,
-		St:        st,
-	}); err != nil {
-		errors = append(errors, err)
-	}
-	return st, errors
+	return confirm(c)
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/disintegration/imaging"
+	"github.com/psaia/imgd/internal/fs"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+func albumWatermark(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	album := st.GetAlbum(c.Args().Get(0))
+	if album == nil {
+		return fmtErr(errCodeMisc, errors.New("Album does not exist"))
+	}
+	var wm *state.Watermark
+	if !c.Bool("remove") {
+		if wm, err = albumWatermarkFromFlags(c); err != nil {
+			return fmtErr(errCodeMisc, err)
+		}
+	}
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		if wm != nil && c.String("image") != "" {
+			filename, err := albumWatermarkUpload(ctx, client, c.String("image"))
+			if err != nil {
+				return fmtErr(errCodeMisc, err)
+			}
+			wm.Image = filename
+		}
+		album.Watermark = wm
+		st = st.UpdateAlbum(*album)
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	if exitCode == nil {
+		prettyLog("The watermark of %s has been updated. Run album sync to apply it", album.Name)
+	}
+	return exitCode
+}
+
+func albumWatermarkFromFlags(c *cli.Context) (*state.Watermark, error) {
+	if (c.String("text") == "") == (c.String("image") == "") {
+		return nil, errors.New("Provide either --text or --image")
+	}
+	if !media.ValidWatermarkPosition(c.String("position")) {
+		return nil, fmt.Errorf("Position must be one of: %s", strings.Join(media.WatermarkPositions, ", "))
+	}
+	if c.Float64("opacity") <= 0 || c.Float64("opacity") > 1 {
+		return nil, errors.New("Opacity must be greater than 0 and at most 1")
+	}
+	if c.Float64("scale") <= 0 || c.Float64("scale") > 1 {
+		return nil, errors.New("Scale must be greater than 0 and at most 1")
+	}
+	wm := &state.Watermark{
+		Text:     c.String("text"),
+		Position: c.String("position"),
+		Opacity:  c.Float64("opacity"),
+		Scale:    c.Float64("scale"),
+	}
+	for _, name := range c.StringSlice("sizes") {
+		size := state.PhotoSizeType(strings.TrimSpace(name))
+		valid := false
+		for _, s := range state.GetPhotoSizeTypes()[1:] {
+			valid = valid || s == size
+		}
+		if !valid {
+			return nil, fmt.Errorf("%s is not a size which can be watermarked", name)
+		}
+		wm.Sizes = append(wm.Sizes, size)
+	}
+	return wm, nil
+}
+
+// albumWatermarkUpload stores the watermark image privately in the lake so later syncs
+// from other machines can still render it.
+func albumWatermarkUpload(ctx context.Context, client provider.Client, file string) (string, error) {
+	if _, err := imaging.Open(file); err != nil {
+		return "", fmt.Errorf("could not read watermark image: %v", err)
+	}
+	hash, err := fs.Hash(file)
+	if err != nil {
+		return "", err
+	}
+	r, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	filename := state.WatermarkImageFilename(hash, ext)
+	if _, err := client.UploadPrivateFile(ctx, filename, r); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
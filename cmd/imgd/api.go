@@ -0,0 +1,477 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/psaia/imgd/internal/fs"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+)
+
+// apiOpenAPI describes the API for generating clients.
+//
+//go:embed openapi.json
+var apiOpenAPI []byte
+
+// apiMaxMemory is how much of an upload is kept in memory, the rest is buffered on disk.
+const apiMaxMemory = 32 << 20
+
+// Request bodies larger than these are refused with 413.
+const (
+	// apiMaxUpload is the size of an upload of photos.
+	apiMaxUpload = 2 << 30
+	// apiMaxBody is the size of every other request.
+	apiMaxBody = 1 << 20
+)
+
+// apiAlbum is an album as the API returns it. Photos is only set when a single album is
+// requested.
+type apiAlbum struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description,omitempty"`
+	URL              string     `json:"url"`
+	PhotoCount       int        `json:"photoCount"`
+	Unlisted         bool       `json:"unlisted,omitempty"`
+	Privacy          string     `json:"privacy"`
+	PrivateOriginals bool       `json:"privateOriginals,omitempty"`
+	Created          string     `json:"created,omitempty"`
+	Updated          string     `json:"updated,omitempty"`
+	Photos           []apiPhoto `json:"photos,omitempty"`
+}
+
+// apiPhoto is a photo as the API returns it. The urls are those of the album it was
+// requested through, otherwise those shared by every album.
+type apiPhoto struct {
+	Hash    string            `json:"hash"`
+	Name    string            `json:"name"`
+	Caption string            `json:"caption,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Albums  []string          `json:"albums,omitempty"`
+	URLs    map[string]string `json:"urls"`
+}
+
+// apiServer serves the API of a lake.
+type apiServer struct {
+	client provider.Client
+	token  string
+	jobs   *apiJobs
+}
+
+func apiServe(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	if c.String("token") == "" {
+		return fmtErr(errCodeMisc, errors.New("Provide a --token clients have to authenticate with"))
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	s := &apiServer{client: client, token: c.String("token"), jobs: newAPIJobs(client, st)}
+	go s.jobs.work(ctx)
+	prettyLog("Serving the API at http://%s/v1", c.String("addr"))
+	if err := http.ListenAndServe(c.String("addr"), s); err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	return nil
+}
+
+// ServeHTTP routes a request after checking its bearer token.
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		apiError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if parts[1] == "openapi.json" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(apiOpenAPI)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.token)) != 1 {
+		apiError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+	body := r.Body
+	r.Body = http.MaxBytesReader(w, body, apiMaxBody)
+	route := r.Method + " " + parts[1]
+	args := parts[2:]
+	switch {
+	case route == "GET albums" && len(args) == 0:
+		s.listAlbums(w, r)
+	case route == "POST albums" && len(args) == 0:
+		s.createAlbum(w, r)
+	case route == "GET albums" && len(args) == 1:
+		s.getAlbum(w, r, args[0])
+	case route == "DELETE albums" && len(args) == 1:
+		s.removeAlbum(w, r, args[0])
+	case route == "GET albums" && len(args) == 2 && args[1] == "download":
+		s.downloadAlbum(w, r, args[0])
+	case route == "POST albums" && len(args) == 2 && args[1] == "photos":
+		r.Body = http.MaxBytesReader(w, body, apiMaxUpload)
+		s.uploadPhotos(w, r, args[0])
+	case route == "DELETE albums" && len(args) == 3 && args[1] == "photos":
+		s.removePhoto(w, r, args[0], args[2])
+	case route == "GET photos" && len(args) == 1:
+		s.getPhoto(w, r, args[0])
+	case route == "PATCH photos" && len(args) == 1:
+		s.updatePhoto(w, r, args[0])
+	case route == "GET jobs" && len(args) == 0:
+		apiJSON(w, http.StatusOK, s.jobs.list())
+	case route == "GET jobs" && len(args) == 1:
+		if job, ok := s.jobs.get(args[0]); ok {
+			apiJSON(w, http.StatusOK, job)
+		} else {
+			apiError(w, http.StatusNotFound, errors.New("Job does not exist"))
+		}
+	default:
+		apiError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *apiServer) listAlbums(w http.ResponseWriter, r *http.Request) {
+	st := s.jobs.state()
+	albums := make([]apiAlbum, 0, len(st.Albums))
+	for _, a := range st.Albums {
+		albums = append(albums, s.newAPIAlbum(a))
+	}
+	apiJSON(w, http.StatusOK, albums)
+}
+
+func (s *apiServer) getAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	st := s.jobs.state()
+	a := st.GetAlbum(id)
+	if a == nil {
+		apiError(w, http.StatusNotFound, errors.New("Album does not exist"))
+		return
+	}
+	album := s.newAPIAlbum(*a)
+	album.Photos = make([]apiPhoto, 0, len(a.Photos))
+	for _, hash := range a.Photos {
+		if p := st.GetPhoto(hash); p != nil {
+			album.Photos = append(album.Photos, s.newAPIPhoto(st, *p, a))
+		}
+	}
+	apiJSON(w, http.StatusOK, album)
+}
+
+func (s *apiServer) createAlbum(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title            string `json:"title"`
+		Description      string `json:"description"`
+		Privacy          string `json:"privacy"`
+		PrivateOriginals bool   `json:"privateOriginals"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apiBodyError(w, err)
+		return
+	}
+	if body.Title == "" {
+		apiError(w, http.StatusBadRequest, errors.New("A title is required"))
+		return
+	}
+	album := state.NewAlbum()
+	album.Name = body.Title
+	album.Description = body.Description
+	album.Privacy = state.PrivacyStripAll
+	album.PrivateOriginals = body.PrivateOriginals
+	if body.Privacy != "" {
+		policy, err := state.ParsePrivacyPolicy(body.Privacy)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+		album.Privacy = policy
+	}
+	s.queue(w, &apiJob{
+		Kind:  "album.create",
+		Album: album.ID,
+		run: func(ctx context.Context, ws *imgd.Workspace) []error {
+			ws.State = ws.State.AddAlbum(album)
+			return nil
+		},
+	})
+}
+
+func (s *apiServer) removeAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	if s.jobs.state().GetAlbum(id) == nil {
+		apiError(w, http.StatusNotFound, errors.New("Album does not exist"))
+		return
+	}
+	s.queue(w, &apiJob{
+		Kind:  "album.remove",
+		Album: id,
+		run: func(ctx context.Context, ws *imgd.Workspace) []error {
+			return ws.RemoveAlbum(ctx, id, imgd.RenderOptions{})
+		},
+	})
+}
+
+// downloadAlbum streams a zip of the originals of an album.
+func (s *apiServer) downloadAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	st := s.jobs.state()
+	album := st.GetAlbum(id)
+	if album == nil {
+		apiError(w, http.StatusNotFound, errors.New("Album does not exist"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", album.ID+".zip"))
+	zw := zip.NewWriter(w)
+	for _, hash := range album.Photos {
+		photo := st.GetPhoto(hash)
+		if photo == nil {
+			continue
+		}
+		b, err := s.client.DownloadFile(r.Context(), photo.RawFilename(state.PhotoSizeTypeOriginal))
+		if err != nil {
+			// The status was already sent so the zip is cut short instead.
+			prettyError("Encountered error during download: %s", err)
+			return
+		}
+		f, err := zw.Create(imgd.DownloadFilename(*photo))
+		if err != nil {
+			return
+		}
+		if _, err := f.Write(b); err != nil {
+			return
+		}
+	}
+	zw.Close()
+}
+
+// uploadPhotos adds the photos of a multipart form to an album through the same pipeline as
+// sync. Photos which aren't part of the upload are kept.
+func (s *apiServer) uploadPhotos(w http.ResponseWriter, r *http.Request, id string) {
+	if s.jobs.state().GetAlbum(id) == nil {
+		apiError(w, http.StatusNotFound, errors.New("Album does not exist"))
+		return
+	}
+	if err := r.ParseMultipartForm(apiMaxMemory); err != nil {
+		apiBodyError(w, err)
+		return
+	}
+	dir, err := ioutil.TempDir("", "imgd-upload")
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, header := range r.MultipartForm.File["photos"] {
+		err := apiSaveUpload(header.Open, filepath.Join(dir, filepath.Base(header.Filename)))
+		if err != nil {
+			os.RemoveAll(dir)
+			apiError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	files, err := fs.DirectoryPhotos(dir)
+	if err == nil && len(files) == 0 {
+		err = errors.New("Upload at least one photo in the photos field")
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.queue(w, &apiJob{
+		Kind:  "album.upload",
+		Album: id,
+		run: func(ctx context.Context, ws *imgd.Workspace) []error {
+			defer os.RemoveAll(dir)
+			plan, err := ws.PlanAddPhotos(id, files)
+			if err != nil {
+				return []error{err}
+			}
+			return ws.SyncAlbum(ctx, plan, imgd.RenderOptions{})
+		},
+	}) {
+		os.RemoveAll(dir)
+	}
+}
+
+func (s *apiServer) removePhoto(w http.ResponseWriter, r *http.Request, id, hash string) {
+	album := s.jobs.state().GetAlbum(id)
+	if album == nil || !album.HasPhoto(hash) {
+		apiError(w, http.StatusNotFound, errors.New("Photo does not exist in album"))
+		return
+	}
+	s.queue(w, &apiJob{
+		Kind:  "album.photo.remove",
+		Album: id,
+		Photo: hash,
+		run: func(ctx context.Context, ws *imgd.Workspace) []error {
+			plan, err := ws.PlanRemovePhotos(id, hash)
+			if err != nil {
+				return []error{err}
+			}
+			return ws.SyncAlbum(ctx, plan, imgd.RenderOptions{})
+		},
+	})
+}
+
+func (s *apiServer) getPhoto(w http.ResponseWriter, r *http.Request, hash string) {
+	st := s.jobs.state()
+	p := st.GetPhoto(hash)
+	if p == nil {
+		apiError(w, http.StatusNotFound, errors.New("Photo does not exist"))
+		return
+	}
+	apiJSON(w, http.StatusOK, s.newAPIPhoto(st, *p, nil))
+}
+
+// updatePhoto changes the caption or tags of a photo. Tags replace the current ones.
+func (s *apiServer) updatePhoto(w http.ResponseWriter, r *http.Request, hash string) {
+	if s.jobs.state().GetPhoto(hash) == nil {
+		apiError(w, http.StatusNotFound, errors.New("Photo does not exist"))
+		return
+	}
+	var body struct {
+		Caption *string   `json:"caption"`
+		Tags    *[]string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apiBodyError(w, err)
+		return
+	}
+	s.queue(w, &apiJob{
+		Kind:  "photo.update",
+		Photo: hash,
+		run: func(ctx context.Context, ws *imgd.Workspace) []error {
+			photo := ws.State.GetPhoto(hash)
+			if photo == nil {
+				return []error{errors.New("Photo does not exist")}
+			}
+			if body.Caption != nil {
+				photo.Caption = *body.Caption
+			}
+			if body.Tags != nil {
+				*photo = photo.Untag(photo.Tags...).Tag(*body.Tags...)
+			}
+			var errs []error
+			ws.State, errs = renderPhotoAlbums(ctx, s.client, ws.State.PersistPhoto(*photo), *photo, "", false)
+			return errs
+		},
+	})
+}
+
+func (s *apiServer) newAPIAlbum(a state.Album) apiAlbum {
+	return apiAlbum{
+		ID:               a.ID,
+		Name:             a.Name,
+		Description:      a.Description,
+		URL:              a.PublicURL(s.client.GetLakeBaseURL()),
+		PhotoCount:       len(a.Photos),
+		Unlisted:         a.Unlisted,
+		Privacy:          string(a.PrivacyPolicy()),
+		PrivateOriginals: a.PrivateOriginals,
+		Created:          apiTime(a.CreatedTime()),
+		Updated:          apiTime(a.UpdatedTime()),
+	}
+}
+
+func (s *apiServer) newAPIPhoto(st state.State, p state.Photo, a *state.Album) apiPhoto {
+	photo := apiPhoto{
+		Hash:    p.Hash,
+		Name:    p.Name,
+		Caption: p.Caption,
+		Tags:    p.Tags,
+		URLs:    make(map[string]string),
+	}
+	for _, album := range st.PhotoAlbums(p) {
+		photo.Albums = append(photo.Albums, album.ID)
+	}
+	base := s.client.GetLakeBaseURL()
+	for _, size := range state.GetPhotoSizeTypes() {
+		if a != nil {
+			photo.URLs[string(size)] = p.PublicURLRawInAlbum(base, *a, size)
+		} else {
+			photo.URLs[string(size)] = p.PublicURLRaw(base, size)
+		}
+	}
+	return photo
+}
+
+// apiSaveUpload copies an uploaded file to disk.
+func apiSaveUpload(open func() (multipart.File, error), dst string) error {
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apiTime formats a time as RFC 3339, or empty when it is unknown.
+func apiTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// queue responds with a queued job, or with 503 when the queue is full. It reports whether
+// the job was queued.
+func (s *apiServer) queue(w http.ResponseWriter, job *apiJob) bool {
+	queued, err := s.jobs.add(job)
+	if err != nil {
+		apiError(w, http.StatusServiceUnavailable, err)
+		return false
+	}
+	apiJSON(w, http.StatusAccepted, queued)
+	return true
+}
+
+func apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		prettyDebug("Error while encoding response: %v", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, err error) {
+	apiJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// apiBodyError responds to a request body which couldn't be read. Bodies cut off by
+// http.MaxBytesReader are too large, anything else is malformed.
+func apiBodyError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "request body too large") {
+		apiError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	apiError(w, http.StatusBadRequest, err)
+}
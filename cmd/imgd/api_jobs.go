@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
+)
+
+// Statuses of an apiJob.
+const (
+	apiJobQueued  = "queued"
+	apiJobRunning = "running"
+	apiJobDone    = "done"
+	apiJobFailed  = "failed"
+)
+
+// apiJobHistory is the amount of finished jobs which are remembered.
+const apiJobHistory = 100
+
+// apiJobQueueSize is the amount of jobs which can wait for the running job.
+const apiJobQueueSize = 100
+
+// errAPIQueueFull is returned when a job can't be queued until others finish.
+var errAPIQueueFull = errors.New("Too many jobs are queued, try again later")
+
+// apiJob is an operation which changes the state. Jobs run one at a time in the order they
+// were queued.
+type apiJob struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"`
+	Status   string   `json:"status"`
+	Album    string   `json:"album,omitempty"`
+	Photo    string   `json:"photo,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Created  string   `json:"created"`
+	Started  string   `json:"started,omitempty"`
+	Finished string   `json:"finished,omitempty"`
+
+	run func(ctx context.Context, w *imgd.Workspace) []error
+}
+
+// apiJobs runs jobs against the state of a lake. Requests read a snapshot of the state which
+// is replaced once a job is done, so they never see a job halfway.
+type apiJobs struct {
+	client provider.Client
+	queue  chan *apiJob
+
+	mu    sync.RWMutex
+	jobs  map[string]*apiJob
+	order []string
+	st    state.State
+}
+
+func newAPIJobs(client provider.Client, st state.State) *apiJobs {
+	return &apiJobs{
+		client: client,
+		queue:  make(chan *apiJob, apiJobQueueSize),
+		jobs:   make(map[string]*apiJob),
+		st:     st,
+	}
+}
+
+// state is the state as of the last finished job.
+func (j *apiJobs) state() state.State {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.st
+}
+
+// add queues a job and returns a copy of it. It returns errAPIQueueFull instead of waiting
+// when the queue is full.
+func (j *apiJobs) add(job *apiJob) (apiJob, error) {
+	job.ID = uuid.New().String()
+	job.Status = apiJobQueued
+	job.Created = state.Timestamp()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	select {
+	case j.queue <- job:
+	default:
+		return apiJob{}, errAPIQueueFull
+	}
+	j.jobs[job.ID] = job
+	j.order = append(j.order, job.ID)
+	// Forget the oldest finished jobs.
+	for len(j.order) > apiJobHistory {
+		oldest := j.jobs[j.order[0]]
+		if oldest.Status != apiJobDone && oldest.Status != apiJobFailed {
+			break
+		}
+		delete(j.jobs, oldest.ID)
+		j.order = j.order[1:]
+	}
+	return *job, nil
+}
+
+// get returns a copy of a job.
+func (j *apiJobs) get(id string) (apiJob, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return apiJob{}, false
+	}
+	return *job, true
+}
+
+// list returns copies of every job, the most recent first.
+func (j *apiJobs) list() []apiJob {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	jobs := make([]apiJob, 0, len(j.order))
+	for idx := len(j.order) - 1; idx >= 0; idx-- {
+		jobs = append(jobs, *j.jobs[j.order[idx]])
+	}
+	return jobs
+}
+
+// work runs the queued jobs until the context is done. Every job works on a copy of the
+// state which is saved and becomes the snapshot once it is done.
+func (j *apiJobs) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-j.queue:
+			j.mu.Lock()
+			job.Status = apiJobRunning
+			job.Started = state.Timestamp()
+			j.mu.Unlock()
+
+			errs := make([]error, 0)
+			st, err := cloneState(j.state())
+			w := &imgd.Workspace{
+				Client:      j.client,
+				State:       st,
+				Concurrency: processingConcurrency(),
+				Debugf:      prettyDebug,
+			}
+			if err == nil {
+				errs = append(errs, job.run(ctx, w)...)
+				if err := w.Save(ctx); err != nil {
+					errs = append(errs, err)
+				}
+			} else {
+				errs = append(errs, err)
+			}
+
+			j.mu.Lock()
+			if err == nil {
+				j.st = w.State
+			}
+			job.Status = apiJobDone
+			for _, e := range errs {
+				job.Status = apiJobFailed
+				job.Errors = append(job.Errors, e.Error())
+			}
+			job.Finished = state.Timestamp()
+			j.mu.Unlock()
+			prettyDebug("Job %s (%s) is %s", job.ID, job.Kind, job.Status)
+		}
+	}
+}
+
+// cloneState copies a state so a job can change it while requests read the original.
+func cloneState(st state.State) (state.State, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return st, err
+	}
+	var cloned state.State
+	err = json.Unmarshal(b, &cloned)
+	return cloned, err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestAPIJobsQueueFull(t *testing.T) {
+	jobs := newAPIJobs(nil, state.State{})
+	for i := 0; i < apiJobQueueSize; i++ {
+		if _, err := jobs.add(&apiJob{Kind: "test"}); err != nil {
+			t.Fatalf("expected job %d to be queued. got %v", i, err)
+		}
+	}
+	if _, err := jobs.add(&apiJob{Kind: "test"}); !errors.Is(err, errAPIQueueFull) {
+		t.Fatalf("expected the queue to be full. got %v", err)
+	}
+	if n := len(jobs.list()); n != apiJobQueueSize {
+		t.Errorf("expected a refused job to be forgotten. got %d jobs", n)
+	}
+}
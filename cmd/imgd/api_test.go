@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+// newTestAPI serves the API of an empty lake from a temporary directory, since jobs save the
+// state locally.
+func newTestAPI(t *testing.T) (*httptest.Server, *memClient) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	client := newMemClient()
+	s := &apiServer{client: client, token: "secret", jobs: newAPIJobs(client, state.New())}
+	go s.jobs.work(ctx)
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		os.Chdir(wd)
+	})
+	return srv, client
+}
+
+func apiRequest(t *testing.T, srv *httptest.Server, method, path, token string, body interface{}, v interface{}) int {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+// waitForJob polls a job until it is finished.
+func waitForJob(t *testing.T, srv *httptest.Server, id string) apiJob {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var job apiJob
+		if status := apiRequest(t, srv, http.MethodGet, "/v1/jobs/"+id, "secret", nil, &job); status != http.StatusOK {
+			t.Fatalf("expected the job to exist. got %d", status)
+		}
+		if job.Status == apiJobDone || job.Status == apiJobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return apiJob{}
+}
+
+func TestAPIToken(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	for _, token := range []string{"", "wrong", "secret2"} {
+		if status := apiRequest(t, srv, http.MethodGet, "/v1/albums", token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("expected token %q to be refused. got %d", token, status)
+		}
+	}
+	if status := apiRequest(t, srv, http.MethodGet, "/v1/albums", "secret", nil, nil); status != http.StatusOK {
+		t.Errorf("expected the token to be accepted. got %d", status)
+	}
+	if status := apiRequest(t, srv, http.MethodGet, "/v1/openapi.json", "", nil, nil); status != http.StatusOK {
+		t.Errorf("expected the description to be public. got %d", status)
+	}
+}
+
+func TestAPIJobLifecycle(t *testing.T) {
+	srv, client := newTestAPI(t)
+
+	var job apiJob
+	status := apiRequest(t, srv, http.MethodPost, "/v1/albums", "secret", map[string]string{"title": "Beach"}, &job)
+	if status != http.StatusAccepted || job.ID == "" || job.Kind != "album.create" {
+		t.Fatalf("expected the album to be queued. got %d %+v", status, job)
+	}
+	if job = waitForJob(t, srv, job.ID); job.Status != apiJobDone {
+		t.Fatalf("expected the job to succeed. got %+v", job)
+	}
+	var albums []apiAlbum
+	apiRequest(t, srv, http.MethodGet, "/v1/albums", "secret", nil, &albums)
+	if len(albums) != 1 || albums[0].ID != job.Album || albums[0].Name != "Beach" {
+		t.Fatalf("expected the created album to be listed. got %+v", albums)
+	}
+	if _, err := client.DownloadFile(context.Background(), state.StateFile); err != nil {
+		t.Errorf("expected the state to be saved in the lake. got %v", err)
+	}
+
+	status = apiRequest(t, srv, http.MethodDelete, "/v1/albums/"+job.Album, "secret", nil, &job)
+	if status != http.StatusAccepted || job.Kind != "album.remove" {
+		t.Fatalf("expected the removal to be queued. got %d %+v", status, job)
+	}
+	if job = waitForJob(t, srv, job.ID); job.Status != apiJobDone {
+		t.Fatalf("expected the job to succeed. got %+v", job)
+	}
+	if status := apiRequest(t, srv, http.MethodGet, "/v1/albums/"+job.Album, "secret", nil, nil); status != http.StatusNotFound {
+		t.Errorf("expected the album to be removed. got %d", status)
+	}
+	var jobs []apiJob
+	apiRequest(t, srv, http.MethodGet, "/v1/jobs", "secret", nil, &jobs)
+	if len(jobs) != 2 || jobs[0].Kind != "album.remove" {
+		t.Errorf("expected the jobs to be listed most recent first. got %+v", jobs)
+	}
+	if status := apiRequest(t, srv, http.MethodGet, "/v1/jobs/missing", "secret", nil, nil); status != http.StatusNotFound {
+		t.Errorf("expected a missing job to be 404. got %d", status)
+	}
+}
+
+func TestAPITokenRequiresBearer(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	for _, auth := range []string{"secret", "Basic secret", "bearer secret", "Bearer  secret"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/albums", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", auth)
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected %q to be refused. got %d", auth, res.StatusCode)
+		}
+	}
+}
+
+func TestAPIBodyTooLarge(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	body := map[string]string{"title": "Beach", "description": strings.Repeat("a", apiMaxBody)}
+	if status := apiRequest(t, srv, http.MethodPost, "/v1/albums", "secret", body, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a large body to be refused. got %d", status)
+	}
+	if status := apiRequest(t, srv, http.MethodPost, "/v1/albums", "secret", "{", nil); status != http.StatusBadRequest {
+		t.Errorf("expected a malformed body to be a bad request. got %d", status)
+	}
+}
+
+func TestAPIUploadAndUpdatePhoto(t *testing.T) {
+	srv, client := newTestAPI(t)
+	var job apiJob
+	apiRequest(t, srv, http.MethodPost, "/v1/albums", "secret", map[string]string{"title": "Beach"}, &job)
+	album := waitForJob(t, srv, job.ID).Album
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	form := &bytes.Buffer{}
+	mw := multipart.NewWriter(form)
+	part, err := mw.CreateFormFile("photos", "beach.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(part, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/albums/"+album+"/photos", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the upload to be queued. got %d", res.StatusCode)
+	}
+	if job = waitForJob(t, srv, job.ID); job.Status != apiJobDone {
+		t.Fatalf("expected the upload to succeed. got %+v", job)
+	}
+
+	var a apiAlbum
+	apiRequest(t, srv, http.MethodGet, "/v1/albums/"+album, "secret", nil, &a)
+	if len(a.Photos) != 1 {
+		t.Fatalf("expected the uploaded photo to be part of the album. got %+v", a)
+	}
+	hash := a.Photos[0].Hash
+	if _, err := client.DownloadFile(context.Background(), hash+"-large.jpg"); err != nil {
+		t.Errorf("expected the sizes of the photo to be uploaded. got %v", err)
+	}
+
+	update := map[string]interface{}{"caption": "Sunset", "tags": []string{"beach"}}
+	apiRequest(t, srv, http.MethodPatch, "/v1/photos/"+hash, "secret", update, &job)
+	if job = waitForJob(t, srv, job.ID); job.Status != apiJobDone {
+		t.Fatalf("expected the update to succeed. got %+v", job)
+	}
+	var p apiPhoto
+	apiRequest(t, srv, http.MethodGet, "/v1/photos/"+hash, "secret", nil, &p)
+	if p.Caption != "Sunset" || len(p.Tags) != 1 || p.Tags[0] != "beach" {
+		t.Errorf("expected the caption and tags to be updated. got %+v", p)
+	}
+
+	apiRequest(t, srv, http.MethodDelete, "/v1/albums/"+album+"/photos/"+hash, "secret", nil, &job)
+	if job = waitForJob(t, srv, job.ID); job.Status != apiJobDone {
+		t.Fatalf("expected the removal to succeed. got %+v", job)
+	}
+	var removed apiAlbum
+	apiRequest(t, srv, http.MethodGet, "/v1/albums/"+album, "secret", nil, &removed)
+	if removed.PhotoCount != 0 || len(removed.Photos) != 0 {
+		t.Errorf("expected the photo to be removed from the album. got %+v", removed)
+	}
+}
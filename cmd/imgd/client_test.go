@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/psaia/imgd/internal/provider"
+)
+
+// memClient is a lake kept in memory.
+type memClient struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemClient() *memClient {
+	return &memClient{files: make(map[string][]byte)}
+}
+
+func (c *memClient) FindLakeName(ctx context.Context) (string, error) { return "lake", nil }
+func (c *memClient) GetLakeName() string                              { return "lake" }
+func (c *memClient) GetLakeBaseURL() string                           { return "https://lake.test" }
+func (c *memClient) SetLakeName(name string)                          {}
+func (c *memClient) CreateLake(ctx context.Context) error             { return nil }
+func (c *memClient) RemoveLake(ctx context.Context)                   {}
+func (c *memClient) UploadFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(media)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[file] = b
+	return file, nil
+}
+func (c *memClient) UploadPrivateFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	return c.UploadFile(ctx, file, media)
+}
+func (c *memClient) DownloadFile(ctx context.Context, file string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.files[file]
+	if !ok {
+		return nil, provider.ErrNotExist
+	}
+	return b, nil
+}
+func (c *memClient) RemoveFile(ctx context.Context, file string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.files[file]; !ok {
+		return provider.ErrNotExist
+	}
+	delete(c.files, file)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+)
+
+// dryRunMetadata is the key of the dry run client in the metadata of the app.
+const dryRunMetadata = "dry-run-client"
+
+// nonInteractiveFlags let imgd run from cron jobs and CI.
+func nonInteractiveFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "Proceed without asking for confirmation",
+			EnvVars: []string{"IMGD_YES"},
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the uploads, removals and page renders instead of changing the lake",
+		},
+	}
+}
+
+// confirm asks whether to proceed. It doesn't ask with --yes or --dry-run and refuses to when
+// stdin isn't a terminal, since nobody could answer.
+func confirm(c *cli.Context) cli.ExitCoder {
+	if c.Bool("yes") || c.Bool("dry-run") {
+		return nil
+	}
+	if !stdinIsTerminal() {
+		return fmtErr(errCodeNotInteractive, nil)
+	}
+	prompt := promptui.Prompt{
+		Label:     "Are you sure you would like to proceed",
+		IsConfirm: true,
+	}
+	if str, _ := prompt.Run(); str != "y" {
+		return fmtErr(errCodeNoop, nil)
+	}
+	return nil
+}
+
+// rejectDryRun refuses --dry-run for commands which write local files, since a dry run
+// only holds back changes to the lake.
+func rejectDryRun(c *cli.Context) cli.ExitCoder {
+	if c.Bool("dry-run") {
+		return fmtErr(errCodeDryRunUnsupported, nil)
+	}
+	return nil
+}
+
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// dryRunProvider hands out clients which only record changes when --dry-run is set.
+type dryRunProvider struct {
+	provider.Provider
+}
+
+func (p dryRunProvider) NewClient(ctx context.Context, c *cli.Context) (provider.Client, error) {
+	client, err := p.Provider.NewClient(ctx, c)
+	if err != nil || !c.Bool("dry-run") {
+		return client, err
+	}
+	dryRun := imgd.NewDryRunClient(client)
+	c.App.Metadata[dryRunMetadata] = dryRun
+	return dryRun, nil
+}
+
+// printDryRun prints what a command would have changed with --dry-run.
+func printDryRun(c *cli.Context) error {
+	dryRun, ok := c.App.Metadata[dryRunMetadata].(*imgd.DryRunClient)
+	if !ok {
+		return nil
+	}
+	var uploads, renders, removals []string
+	for _, op := range dryRun.Planned() {
+		switch {
+		case op.Op == imgd.OpCreateLake:
+			uploads = append(uploads, "+ "+op.File+" (new lake)")
+		case op.Op == imgd.OpRemoveLake:
+			removals = append(removals, "- "+op.File+" (lake)")
+		case op.Op == imgd.OpRemove:
+			removals = append(removals, "- "+op.File)
+		case isPageFile(op.File):
+			renders = append(renders, "~ "+op.File)
+		case op.Op == imgd.OpUploadPrivate:
+			uploads = append(uploads, "+ "+op.File+" (private)")
+		default:
+			uploads = append(uploads, "+ "+op.File)
+		}
+	}
+	prettyLog("\nDry run, nothing was changed.\n\nUploads:\n%s\n\nPage renders:\n%s\n\nRemovals:\n%s\n",
+		dryRunList(uploads), dryRunList(renders), dryRunList(removals))
+	return nil
+}
+
+func dryRunList(files []string) string {
+	if len(files) == 0 {
+		return "None."
+	}
+	return strings.Join(files, "\n")
+}
+
+// isPageFile is true for the files a render publishes rather than photos.
+func isPageFile(file string) bool {
+	if strings.HasPrefix(file, "_themes/") {
+		return true
+	}
+	switch path.Ext(file) {
+	case ".html", ".xml", ".json", ".txt":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runNonInteractive runs an app with the flags of nonInteractiveFlags and returns what the
+// action returned.
+func runNonInteractive(t *testing.T, action func(c *cli.Context) cli.ExitCoder, args ...string) cli.ExitCoder {
+	var result cli.ExitCoder
+	app := cli.NewApp()
+	app.Flags = nonInteractiveFlags()
+	app.Action = func(c *cli.Context) error {
+		result = action(c)
+		return nil
+	}
+	if err := app.Run(append([]string{"imgd"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// withoutTerminal replaces stdin with a pipe for the rest of the test.
+func withoutTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+		w.Close()
+	})
+}
+
+func TestConfirmWithoutTerminal(t *testing.T) {
+	withoutTerminal(t)
+	err := runNonInteractive(t, confirm)
+	if err == nil || err.ExitCode() != int(errCodeNotInteractive) {
+		t.Fatalf("expected to refuse asking without a terminal. got %v", err)
+	}
+	for _, args := range [][]string{{"--yes"}, {"-y"}, {"--dry-run"}} {
+		if err := runNonInteractive(t, confirm, args...); err != nil {
+			t.Errorf("expected %v to proceed without asking. got %v", args, err)
+		}
+	}
+}
+
+func TestConfirmYesFromEnv(t *testing.T) {
+	withoutTerminal(t)
+	os.Setenv("IMGD_YES", "1")
+	defer os.Unsetenv("IMGD_YES")
+	if err := runNonInteractive(t, confirm); err != nil {
+		t.Fatalf("expected IMGD_YES to proceed without asking. got %v", err)
+	}
+}
+
+func TestRejectDryRun(t *testing.T) {
+	if err := runNonInteractive(t, rejectDryRun); err != nil {
+		t.Errorf("expected commands to run without --dry-run. got %v", err)
+	}
+	err := runNonInteractive(t, rejectDryRun, "--dry-run")
+	if err == nil || err.ExitCode() != int(errCodeDryRunUnsupported) {
+		t.Errorf("expected --dry-run to be refused. got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func duplicates(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	if missing := len(st.PhotosNeedingBackfill()); missing > 0 {
+		prettyLog("%d photos have not been analyzed yet and are skipped. Run photo backfill to include them.", missing)
+	}
+	groups := st.Duplicates(c.Int("threshold"))
+	if len(groups) == 0 {
+		prettyLog("There are no near duplicates.")
+		return nil
+	}
+	prettyLog("Near duplicates:")
+	for i, group := range groups {
+		fmt.Print(prettyLogStr("%d.", i+1))
+		for _, photo := range group {
+			names := make([]string, 0)
+			for _, a := range st.PhotoAlbums(photo) {
+				names = append(names, a.Name)
+			}
+			fmt.Print(prettyLogStr("   %s  %s  [%s]", photo.Hash, photo.Name, strings.Join(names, ", ")))
+		}
+	}
+	return nil
+}
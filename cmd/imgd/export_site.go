@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/fs"
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+// exportPhotoJob is a published file of a photo which is copied into the exported site.
+type exportPhotoJob struct {
+	photo    state.Photo
+	album    state.Album
+	size     state.PhotoSizeType
+	filename string
+	// src is the local original of the photo, empty to download the file from the lake.
+	src string
+}
+
+func exportSite(c *cli.Context) error {
+	if err := rejectDryRun(c); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	if c.Args().Get(0) == "" {
+		return fmtErr(errCodeMisc, errors.New("Provide the directory to export to"))
+	}
+	tplDir, theme, err := themeFromFlags(c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	originals, err := localOriginals(st, c.StringSlice("originals"))
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	dirPath, err := fs.CreateDirectoryIfNew(c.Args().Get(0))
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	var errs []error
+	func() {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		errs = gallery.ExportSite(gallery.ExportOptions{
+			St:        st,
+			TplDir:    tplDir,
+			ThemeName: theme,
+			Write: func(slug string, b []byte) error {
+				return writeExportFile(dirPath, slug, b)
+			},
+		})
+		errs = append(errs, exportPhotosRun(ctx, client, dirPath, exportPhotoJobs(st, originals))...)
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error during export: %s", err)
+	}
+	if len(errs) > 0 {
+		return fmtErr(errCodeMisc, errors.New("The site was only partially exported"))
+	}
+	prettyLog("The site has been exported to %s", dirPath)
+	return nil
+}
+
+// localOriginals finds the originals of photos in the state within the given directories,
+// by hash.
+func localOriginals(st state.State, dirs []string) (map[string]string, error) {
+	originals := make(map[string]string)
+	for _, dir := range dirs {
+		files, err := fs.DirectoryPhotos(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			hash, err := fs.Hash(file)
+			if err != nil {
+				return nil, err
+			}
+			if st.GetPhoto(hash) != nil {
+				originals[hash] = file
+			}
+		}
+	}
+	return originals, nil
+}
+
+// exportPhotoJobs lists every file of every photo as it is published within each album.
+// Files shared by albums are only copied once.
+func exportPhotoJobs(st state.State, originals map[string]string) []exportPhotoJob {
+	jobs := make([]exportPhotoJob, 0)
+	seen := make(map[string]bool)
+	for _, album := range st.Albums {
+		for _, hash := range album.Photos {
+			photo := st.GetPhoto(hash)
+			if photo == nil {
+				continue
+			}
+			for _, size := range state.GetPhotoSizeTypes() {
+				filename := photo.AlbumFilename(album, size)
+				if seen[filename] {
+					continue
+				}
+				seen[filename] = true
+				job := exportPhotoJob{photo: *photo, album: album, size: size, filename: filename}
+				// The sanitized copy of a private original can only come from the lake.
+				if !(size == state.PhotoSizeTypeOriginal && photo.PrivateOriginal) {
+					job.src = originals[hash]
+				}
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs
+}
+
+// exportPhotosRun copies the files of photos into the site. They are regenerated from local
+// originals when there are any, otherwise they are downloaded from the lake.
+func exportPhotosRun(ctx context.Context, client provider.Client, dirPath string, jobs []exportPhotoJob) []error {
+	var mu sync.Mutex
+	errors := make([]error, 0)
+	maxWorkers := processingConcurrency()
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+	watermarks := make(map[string]*media.WatermarkOptions)
+	for _, job := range jobs {
+		if job.src == "" || !job.album.Watermark.Applies(job.size) {
+			continue
+		}
+		if _, ok := watermarks[job.album.ID]; ok {
+			continue
+		}
+		wm, err := imgd.LoadWatermark(ctx, client, job.album.Watermark)
+		if err != nil {
+			return append(errors, err)
+		}
+		watermarks[job.album.ID] = wm
+	}
+
+	for _, job := range jobs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			prettyDebug("Failed to acquire semaphore: %v", err)
+			break
+		}
+		go func(j exportPhotoJob) {
+			defer sem.Release(1)
+			b, err := exportPhoto(ctx, client, j, watermarks[j.album.ID])
+			if err == nil {
+				err = writeExportFile(dirPath, j.filename, b)
+			}
+			if err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+			}
+		}(job)
+	}
+	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
+		prettyDebug("Failed to acquire semaphore: %v", err)
+	}
+	return errors
+}
+
+func exportPhoto(ctx context.Context, client provider.Client, job exportPhotoJob, wm *media.WatermarkOptions) ([]byte, error) {
+	if job.src == "" {
+		return client.DownloadFile(ctx, job.filename)
+	}
+	raw, err := ioutil.ReadFile(job.src)
+	if err != nil || job.size == state.PhotoSizeTypeOriginal {
+		return raw, err
+	}
+	if !job.album.Watermark.Applies(job.size) {
+		wm = nil
+	}
+	return imgd.RenderDerivative(raw, job.photo, job.size, wm)
+}
+
+// writeExportFile writes a file of the site, creating its directory.
+func writeExportFile(dirPath, slug string, b []byte) error {
+	dst := filepath.Join(dirPath, filepath.FromSlash(slug))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, b, 0644)
+}
@@ -10,9 +10,12 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/media"
 	"github.com/psaia/imgd/internal/provider"
 	"github.com/psaia/imgd/internal/provider/providers/gcs"
 	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
 	"github.com/urfave/cli/v2"
 )
 
@@ -27,16 +30,20 @@ const (
 	errCodeCorruptState
 	errCodeBadConnection
 	errCodeEmptyRemoteState
+	errCodeNotInteractive
+	errCodeDryRunUnsupported
 )
 
 var cliErrors = map[ErrorCode]string{
-	errCodeUnauthenticated:  "Could not authenticate with provider.",
-	errCodeUnknownProvider:  "The provider you've provided is not yet supported.",
-	errCodeMisc:             "Problem: %v",
-	errCodeCorruptState:     "Your state is corrupt. You should create a new workspace.",
-	errCodeBadConnection:    "Unable to connect to storage client. Check your credentials and internet connection.",
-	errCodeNoop:             "Aborted",
-	errCodeEmptyRemoteState: "There's a local state, but no remote state. Check to make sure you're using the correct provider account.",
+	errCodeUnauthenticated:   "Could not authenticate with provider.",
+	errCodeUnknownProvider:   "The provider you've provided is not yet supported.",
+	errCodeMisc:              "Problem: %v",
+	errCodeCorruptState:      "Your state is corrupt. You should create a new workspace.",
+	errCodeBadConnection:     "Unable to connect to storage client. Check your credentials and internet connection.",
+	errCodeNoop:              "Aborted",
+	errCodeEmptyRemoteState:  "There's a local state, but no remote state. Check to make sure you're using the correct provider account.",
+	errCodeNotInteractive:    "Refusing to ask for confirmation because stdin is not a terminal. Pass --yes to proceed or --dry-run to see what would change.",
+	errCodeDryRunUnsupported: "--dry-run only holds back changes to the lake, and this command writes local files. Run it without --dry-run.",
 }
 
 func main() {
@@ -62,7 +69,8 @@ func main() {
 
 	app := &cli.App{
 		Name:  "imgd",
-		Flags: providerFlags,
+		Flags: append(providerFlags, nonInteractiveFlags()...),
+		After: printDryRun,
 		Commands: []*cli.Command{
 			{
 				Name:  "album",
@@ -88,6 +96,15 @@ func main() {
 								Value: "",
 								Usage: "Provide a description for your photo album",
 							},
+							&cli.StringFlag{
+								Name:  "privacy",
+								Value: "",
+								Usage: "Metadata published with each photo: keep, strip-location or strip-all (default)",
+							},
+							&cli.BoolFlag{
+								Name:  "private-originals",
+								Usage: "Keep the true originals private and only publish a sanitized copy. Albums which strip metadata always do",
+							},
 						},
 						Action: albumCreate,
 					},
@@ -95,7 +112,7 @@ func main() {
 						Name:   "sync",
 						Usage:  "sync all photos within a folder to an album",
 						Action: albumSync,
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:  "title",
 								Value: "",
@@ -106,12 +123,99 @@ func main() {
 								Value: "",
 								Usage: "Update the description of the photo album",
 							},
+							&cli.StringFlag{
+								Name:  "privacy",
+								Value: "",
+								Usage: "Update the metadata published with each photo: keep, strip-location or strip-all",
+							},
+							&cli.BoolFlag{
+								Name:  "private-originals",
+								Usage: "Keep the true originals private and only publish a sanitized copy. Albums which strip metadata always do",
+							},
+							forceRenderFlag(),
+						}, themeFlags()...),
+					},
+					{
+						Name:   "edit",
+						Usage:  "update the details and theme of an album",
+						Action: albumEdit,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "title",
+								Usage: "Update the title of the photo album",
+							},
+							&cli.StringFlag{
+								Name:  "description",
+								Usage: "Update the description of the photo album",
+							},
+							&cli.StringFlag{
+								Name:  "cover",
+								Usage: "Hash of the photo representing the album. Empty to use the first photo",
+							},
+							&cli.IntFlag{
+								Name:  "page-size",
+								Usage: "Amount of photos on each page of the album. 0 to use the page size of the workspace",
+							},
+							&cli.BoolFlag{
+								Name:  "unlisted",
+								Usage: "Leave the album out of the index page, feeds and sitemap and ask search engines not to index it",
+							},
+							&cli.StringFlag{
+								Name:  "theme",
+								Usage: "Render the album with a different theme than the workspace. Empty to use the workspace theme",
+							},
+							&cli.StringSliceFlag{
+								Name:  "setting",
+								Usage: "Set a theme setting as key=value, e.g. columns=4, overriding the workspace. An empty value removes it",
+							},
+							templatesDirFlag(),
+							forceRenderFlag(),
+						},
+					},
+					{
+						Name:   "watermark",
+						Usage:  "draw a watermark on the published sizes of an album",
+						Action: albumWatermark,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "text",
+								Usage: "Text to use as the watermark",
+							},
+							&cli.StringFlag{
+								Name:  "image",
+								Usage: "Path to an image (preferably a transparent PNG) to use as the watermark",
+							},
+							&cli.StringFlag{
+								Name:  "position",
+								Value: "bottom-right",
+								Usage: fmt.Sprintf("Where the watermark is drawn: %s", strings.Join(media.WatermarkPositions, ", ")),
+							},
+							&cli.Float64Flag{
+								Name:  "opacity",
+								Value: 0.5,
+								Usage: "Opacity of the watermark from 0 to 1",
+							},
+							&cli.Float64Flag{
+								Name:  "scale",
+								Value: 0.2,
+								Usage: "Width of the watermark relative to the width of the photo",
+							},
+							&cli.StringSliceFlag{
+								Name:  "sizes",
+								Value: cli.NewStringSlice("small", "medium", "large"),
+								Usage: "Sizes to watermark. Originals are never watermarked",
+							},
+							&cli.BoolFlag{
+								Name:  "remove",
+								Usage: "Remove the watermark from the album",
+							},
 						},
 					},
 					{
 						Name:   "remove",
 						Usage:  "remove album",
 						Action: albumRemove,
+						Flags:  themeFlags(),
 					},
 					{
 						Name:   "expand",
@@ -125,6 +229,183 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "photo",
+				Usage: "manage individual photos across all albums",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "backfill",
+						Usage:  "extract metadata for photos which were synced before it was supported",
+						Action: photoBackfill,
+					},
+					{
+						Name:      "caption",
+						Usage:     "set the caption of a photo, or remove it when empty",
+						ArgsUsage: "PHOTO_HASH CAPTION",
+						Action:    photoCaption,
+						Flags:     []cli.Flag{templatesDirFlag(), forceRenderFlag()},
+					},
+					{
+						Name:      "tag",
+						Usage:     "add tags to a photo, or list them without any",
+						ArgsUsage: "PHOTO_HASH [TAG...]",
+						Action:    photoTag,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "remove",
+								Usage: "Remove the tags instead of adding them",
+							},
+							templatesDirFlag(),
+							forceRenderFlag(),
+						},
+					},
+					{
+						Name:   "focus",
+						Usage:  "set the point cropped sizes of a photo are centered on",
+						Action: photoFocus,
+						Flags: []cli.Flag{
+							&cli.Float64Flag{
+								Name:  "x",
+								Usage: "Horizontal position from 0 (left) to 1 (right)",
+							},
+							&cli.Float64Flag{
+								Name:  "y",
+								Usage: "Vertical position from 0 (top) to 1 (bottom)",
+							},
+							&cli.BoolFlag{
+								Name:  "auto",
+								Usage: "Remove the focal point and let imgd find the most interesting region",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "workspace",
+				Usage: "defaults for every album",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "set",
+						Usage:  "set the title, default theme and theme settings of the workspace",
+						Action: workspaceSet,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "title",
+								Usage: "Title of the gallery shown on the index page",
+							},
+							&cli.IntFlag{
+								Name:  "page-size",
+								Usage: fmt.Sprintf("Amount of photos on each page of an album. 0 for %d", state.DefaultPageSize),
+							},
+							&cli.StringFlag{
+								Name:  "robots",
+								Usage: "Path to a file with the rules of robots.txt, which replace the generated ones. Empty to generate them again",
+							},
+							&cli.StringFlag{
+								Name:  "theme",
+								Usage: "Name of the theme albums are rendered with. Empty for the default theme",
+							},
+							&cli.StringSliceFlag{
+								Name:  "setting",
+								Usage: "Set a theme setting as key=value, e.g. accent=#333. An empty value removes it",
+							},
+							templatesDirFlag(),
+							forceRenderFlag(),
+						},
+					},
+				},
+			},
+			{
+				Name:  "theme",
+				Usage: "themes control how the html files of albums look",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "list the bundled and installed themes",
+						Action: themeList,
+						Flags:  []cli.Flag{templatesDirFlag()},
+					},
+					{
+						Name:   "install",
+						Usage:  "install a theme from a directory, .zip or .tar.gz archive",
+						Action: themeInstall,
+					},
+					{
+						Name:   "validate",
+						Usage:  "check a theme directory for problems",
+						Action: themeValidate,
+					},
+				},
+			},
+			{
+				Name:   "duplicates",
+				Usage:  "find near duplicate photos across all albums",
+				Action: duplicates,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "threshold",
+						Value: state.DefaultDuplicateThreshold,
+						Usage: "How different (0-64) two photos may be to still be considered duplicates",
+					},
+				},
+			},
+			{
+				Name:   "serve",
+				Usage:  "preview the gallery locally, re-rendering pages whenever the theme changes",
+				Action: serve,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Value: "localhost:8080",
+						Usage: "Address to serve the preview on",
+					},
+					&cli.StringSliceFlag{
+						Name:  "originals",
+						Usage: "Directory with originals to generate the sizes from instead of downloading them. Can be repeated",
+					},
+				}, themeFlags()...),
+			},
+			{
+				Name:  "api",
+				Usage: "manage the lake over HTTP, e.g. from a desktop client",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "serve",
+						Usage:  "serve the JSON API described at /v1/openapi.json",
+						Action: apiServe,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "addr",
+								Value: "localhost:8787",
+								Usage: "Address to serve the API on",
+							},
+							&cli.StringFlag{
+								Name:    "token",
+								Usage:   "Token clients authenticate with as Authorization: Bearer TOKEN",
+								EnvVars: []string{"IMGD_API_TOKEN"},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "copy the gallery out of the lake",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "site",
+						Usage:     "export every album as a static site with relative links to a new directory",
+						ArgsUsage: "DIR",
+						Action:    exportSite,
+						Flags: append([]cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "originals",
+								Usage: "Directory with originals to generate the sizes from instead of downloading them. Can be repeated",
+							},
+						}, themeFlags()...),
+					},
+				},
+			},
 		},
 	}
 
@@ -134,6 +415,46 @@ func main() {
 	}
 }
 
+// themeFlags choose the theme used to generate the html files.
+func themeFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "theme",
+			Value:   "",
+			Usage:   "Render with this theme instead of the themes of the album and workspace",
+			EnvVars: []string{"IMGD_THEME"},
+		},
+		templatesDirFlag(),
+	}
+}
+
+// templatesDirFlag points to a directory of themes which are still being worked on.
+func templatesDirFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "templates-dir",
+		Value:   "",
+		Usage:   "Directory of themes which override the installed and bundled themes of the same name",
+		EnvVars: []string{"IMGD_TEMPLATES_DIR"},
+	}
+}
+
+// forceRenderFlag uploads every html file even when it didn't change, e.g. after editing a
+// theme without changing its version.
+func forceRenderFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "force-render",
+		Usage: "Upload every html file and theme asset instead of only the ones which changed",
+	}
+}
+
+// themeFromFlags returns the templates directory and theme name after making sure the theme exists.
+func themeFromFlags(c *cli.Context) (string, string, error) {
+	if _, err := gallery.LoadTheme(c.String("templates-dir"), c.String("theme")); err != nil {
+		return "", "", err
+	}
+	return c.String("templates-dir"), c.String("theme"), nil
+}
+
 func fmtErr(code ErrorCode, err error) cli.ExitCoder {
 	if err != nil {
 		return cli.Exit(prettyErrorStr(fmt.Sprintf(cliErrors[code], err)), int(code))
@@ -151,7 +472,7 @@ func activeProviders() []string {
 func getProvider(name string) (provider.Provider, error) {
 	switch {
 	case name == gcs.Name:
-		return gcs.NewProvider(), nil
+		return dryRunProvider{gcs.NewProvider()}, nil
 	// case name == aws.Name:
 	// 	return aws.NewProvider(), nil
 	default:
@@ -160,94 +481,34 @@ func getProvider(name string) (provider.Provider, error) {
 	}
 }
 
-// Find the remote state if it exists. If one does not exists, returns nil, nil.
-func findRemoteState(ctx context.Context, client provider.Client) (state.State, cli.ExitCoder) {
-	lakeName, err := client.FindLakeName(ctx)
-	if errors.Is(err, provider.ErrNotExist) {
-		return state.State{}, nil
-	} else if err != nil {
-		return state.State{}, fmtErr(errCodeMisc, err)
-	}
-	client.SetLakeName(lakeName)
-
-	remoteState, err := state.FetchRemote(ctx, client)
+// openWorkspace provisions the state of the lake, see imgd.Open.
+func openWorkspace(ctx context.Context, client provider.Client) (*imgd.Workspace, cli.ExitCoder) {
+	w, err := imgd.Open(ctx, client)
 	if errors.Is(err, provider.ErrBadConnection) {
-		return state.State{}, fmtErr(errCodeBadConnection, nil)
-	} else if errors.Is(err, provider.ErrNotExist) {
-		return state.State{}, nil
+		return nil, fmtErr(errCodeBadConnection, nil)
 	} else if err != nil {
-		return state.State{}, fmtErr(errCodeMisc, err)
+		return nil, fmtErr(errCodeMisc, err)
 	}
-	if err := remoteState.SaveLocal(); err != nil {
-		return state.State{}, fmtErr(errCodeMisc, err)
-	}
-	return remoteState, nil
-}
-
-func findLocalState(ctx context.Context, client provider.Client) (state.State, cli.ExitCoder) {
-	localState, err := state.FetchLocal()
-	if os.IsNotExist(err) {
-		return state.State{}, nil
-	} else if err != nil {
-		return state.State{}, fmtErr(errCodeMisc, err)
-	}
-	client.SetLakeName(localState.LakeName)
-	return localState, nil
-}
-
-func createNewState(ctx context.Context, client provider.Client) (state.State, cli.ExitCoder) {
-	st := state.New()
-	client.SetLakeName(st.LakeName)
-	err := client.CreateLake(ctx)
-	if err != nil {
-		prettyDebug("Error while creating new lake.")
-		return state.State{}, fmtErr(errCodeMisc, err)
-	}
-	return saveState(ctx, client, st)
+	w.Concurrency = processingConcurrency()
+	w.Debugf = prettyDebug
+	return w, nil
 }
 
 func saveState(ctx context.Context, client provider.Client, st state.State) (state.State, cli.ExitCoder) {
-	if err := st.SaveLocal(); err != nil {
-		prettyDebug("Error while saving state locally.")
-		return state.State{}, fmtErr(errCodeMisc, err)
-	}
-	if err := st.SaveRemote(ctx, client); err != nil {
-		prettyDebug("Error while saving state remotely.")
+	w := imgd.Workspace{Client: client, State: st}
+	if err := w.Save(ctx); err != nil {
+		prettyDebug("Error while saving state.")
 		return state.State{}, fmtErr(errCodeMisc, err)
 	}
 	return st, nil
 }
 
 func provisionState(ctx context.Context, client provider.Client) (state.State, cli.ExitCoder) {
-	localState, err := findLocalState(ctx, client)
+	w, err := openWorkspace(ctx, client)
 	if err != nil {
-		prettyDebug("Error occurred while finding local state.")
 		return state.State{}, err
 	}
-	if !isEmptyState(localState) {
-		prettyDebug("Found local state file.")
-		return localState, nil
-	}
-	remoteState, err := findRemoteState(ctx, client)
-	if err != nil {
-		prettyDebug("Error occurred while finding remote state.")
-		return state.State{}, err
-	}
-	if !isEmptyState(remoteState) {
-		prettyDebug("Refreshed from remote state.")
-		return remoteState, nil
-	}
-	prettyDebug("Could not detect a local or remote state so provisioning a new workspace.")
-	newState, err := createNewState(ctx, client)
-	if err != nil {
-		prettyDebug("Error occurred while creating new state.")
-		return state.State{}, err
-	}
-	return newState, nil
-}
-
-func isEmptyState(st state.State) bool {
-	return st.ID == ""
+	return w.State, nil
 }
 
 func processingConcurrency() int {
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+func photoBackfill(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	photos := st.PhotosNeedingBackfill()
+	if len(photos) == 0 {
+		prettyLog("Every photo is already up to date.")
+		return nil
+	}
+	var errs []error
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		st, errs = photoBackfillRun(ctx, st, client, photos)
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error during backfill: %s", err)
+	}
+	if exitCode == nil {
+		prettyLog("%d of %d photos have been backfilled", len(photos)-len(errs), len(photos))
+	}
+	return exitCode
+}
+
+// photoBackfillRun downloads the original of every photo and extracts whatever
+// was not available when it was first synced.
+func photoBackfillRun(ctx context.Context, st state.State, client provider.Client, photos []state.Photo) (state.State, []error) {
+	var mu sync.Mutex
+	errors := make([]error, 0)
+	maxWorkers := processingConcurrency()
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+
+	for _, photo := range photos {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			prettyDebug("Failed to acquire semaphore: %v", err)
+			break
+		}
+		go func(photo state.Photo) {
+			defer sem.Release(1)
+			b, err := client.DownloadFile(ctx, photo.RawFilename(state.PhotoSizeTypeOriginal))
+			if err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			if !photo.Metadata.Extracted {
+				photo.Metadata = media.ReadMetadata(b)
+				prettyDebug("%s: Metadata extracted", photo.Hash)
+			}
+			if !photo.Analyzed() {
+				if err := imgd.AnalyzeOriginal(b, &photo); err != nil {
+					mu.Lock()
+					errors = append(errors, fmt.Errorf("%s: %v", photo.Name, err))
+					mu.Unlock()
+					return
+				}
+				prettyDebug("%s: Analyzed", photo.Hash)
+			}
+			mu.Lock()
+			st = st.PersistPhoto(photo)
+			mu.Unlock()
+		}(photo)
+	}
+	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
+		prettyDebug("Failed to acquire semaphore: %v", err)
+	}
+	return st, errors
+}
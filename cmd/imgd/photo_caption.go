@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+func photoCaption(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	photo := st.GetPhoto(c.Args().Get(0))
+	if photo == nil {
+		return fmtErr(errCodeMisc, errors.New("Photo does not exist"))
+	}
+	photo.Caption = c.Args().Get(1)
+	st = st.PersistPhoto(*photo)
+	var errs []error
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		st, errs = renderPhotoAlbums(ctx, client, st, *photo, c.String("templates-dir"), c.Bool("force-render"))
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error while regenerating html files: %s", err)
+	}
+	if exitCode == nil {
+		prettyLog("The caption of %s has been updated", photo.Name)
+	}
+	return exitCode
+}
+
+// renderPhotoAlbums regenerates the html files of every album a photo belongs to.
+func renderPhotoAlbums(ctx context.Context, client provider.Client, st state.State, photo state.Photo, tplDir string, force bool) (state.State, []error) {
+	var errs []error
+	for _, album := range st.PhotoAlbums(photo) {
+		var albumErrs []error
+		st, albumErrs = gallery.CreateTemplatesFromState(ctx, client, st, album, tplDir, "", force)
+		errs = append(errs, albumErrs...)
+	}
+	return st, errs
+}
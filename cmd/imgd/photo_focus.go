@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+)
+
+func photoFocus(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	photo := st.GetPhoto(c.Args().Get(0))
+	if photo == nil {
+		return fmtErr(errCodeMisc, errors.New("Photo does not exist"))
+	}
+	if c.Bool("auto") {
+		photo.FocalPoint = nil
+	} else if c.IsSet("x") || c.IsSet("y") {
+		x, y := c.Float64("x"), c.Float64("y")
+		if x < 0 || x > 1 || y < 0 || y > 1 {
+			return fmtErr(errCodeMisc, errors.New("The focal point must be between 0 and 1 on both axes"))
+		}
+		photo.FocalPoint = &state.FocalPoint{X: x, Y: y}
+	} else {
+		return fmtErr(errCodeMisc, errors.New("Provide --x and --y or --auto"))
+	}
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		if err := photoFocusRun(ctx, client, *photo); err != nil {
+			return fmtErr(errCodeMisc, err)
+		}
+		st = st.PersistPhoto(*photo)
+		// Watermarked copies are regenerated by the next sync of their album.
+		for _, album := range st.Albums {
+			for _, size := range state.GetFillPhotoSizeTypes() {
+				if album.Watermark.Applies(size) {
+					st = st.SetWatermarked(album, *photo, "")
+				}
+			}
+		}
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	if exitCode == nil {
+		prettyLog("The cropped sizes of %s have been regenerated", photo.Name)
+	}
+	return exitCode
+}
+
+// photoFocusRun regenerates every cropped size of a photo from its original.
+func photoFocusRun(ctx context.Context, client provider.Client, photo state.Photo) error {
+	raw, err := client.DownloadFile(ctx, photo.RawFilename(state.PhotoSizeTypeOriginal))
+	if err != nil {
+		return err
+	}
+	for _, size := range state.GetFillPhotoSizeTypes() {
+		b, err := imgd.RenderDerivative(raw, photo, size, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := client.UploadFile(ctx, photo.RawFilename(size), bytes.NewReader(b)); err != nil {
+			return err
+		}
+		prettyDebug("%s: Regenerated", photo.RawFilename(size))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/urfave/cli/v2"
+)
+
+func photoTag(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	photo := st.GetPhoto(c.Args().Get(0))
+	if photo == nil {
+		return fmtErr(errCodeMisc, errors.New("Photo does not exist"))
+	}
+	tags := c.Args().Tail()
+	if len(tags) == 0 {
+		prettyLog("Tags of %s: %s", photo.Name, strings.Join(photo.Tags, ", "))
+		return nil
+	}
+	if c.Bool("remove") {
+		*photo = photo.Untag(tags...)
+	} else {
+		*photo = photo.Tag(tags...)
+	}
+	st = st.PersistPhoto(*photo)
+	var errs []error
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		st, errs = renderPhotoAlbums(ctx, client, st, *photo, c.String("templates-dir"), c.Bool("force-render"))
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error while regenerating html files: %s", err)
+	}
+	if exitCode == nil {
+		prettyLog("The tags of %s are now: %s", photo.Name, strings.Join(photo.Tags, ", "))
+	}
+	return exitCode
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/pkg/imgd"
+	"github.com/urfave/cli/v2"
+)
+
+func serve(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	tplDir, theme, err := themeFromFlags(c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	originals, err := localOriginals(st, c.StringSlice("originals"))
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	jobs := make(map[string]exportPhotoJob)
+	for _, job := range exportPhotoJobs(st, originals) {
+		jobs[job.filename] = job
+	}
+	photos := &previewPhotos{client: client, jobs: jobs, cache: newPreviewCache(previewCacheSize), watermarks: make(map[string]*media.WatermarkOptions)}
+	addr := c.String("addr")
+	handler := gallery.NewPreview(gallery.PreviewOptions{
+		St:        st,
+		TplDir:    tplDir,
+		ThemeName: theme,
+		BaseURL:   fmt.Sprintf("http://%s", addr),
+		Open:      photos.open,
+	})
+	prettyLog("Previewing the gallery at http://%s/index.html", addr)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	return nil
+}
+
+// previewCacheSize is the most bytes of generated sizes the preview keeps in memory.
+const previewCacheSize = 256 << 20
+
+// previewPhotos serves the files of photos to the preview. Sizes generated from local
+// originals are kept in memory since they are slow to generate. The least recently served
+// ones are dropped once they take up more than previewCacheSize.
+type previewPhotos struct {
+	client     provider.Client
+	jobs       map[string]exportPhotoJob
+	mu         sync.Mutex
+	cache      *previewCache
+	watermarks map[string]*media.WatermarkOptions
+}
+
+func (p *previewPhotos) open(ctx context.Context, slug string) ([]byte, error) {
+	job, ok := p.jobs[slug]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	if job.src == "" {
+		b, err := p.client.DownloadFile(ctx, slug)
+		if errors.Is(err, provider.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		return b, err
+	}
+	p.mu.Lock()
+	b, ok := p.cache.get(slug)
+	wm, loaded := p.watermarks[job.album.ID]
+	p.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+	if !loaded && job.album.Watermark.Applies(job.size) {
+		var err error
+		if wm, err = imgd.LoadWatermark(ctx, p.client, job.album.Watermark); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.watermarks[job.album.ID] = wm
+		p.mu.Unlock()
+	}
+	b, err := exportPhoto(ctx, p.client, job, wm)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.cache.add(slug, b)
+	p.mu.Unlock()
+	return b, nil
+}
+
+// previewCache keeps the most recently used files up to a total number of bytes.
+type previewCache struct {
+	max   int
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type previewCacheItem struct {
+	slug string
+	b    []byte
+}
+
+func newPreviewCache(max int) *previewCache {
+	return &previewCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *previewCache) get(slug string) ([]byte, bool) {
+	e, ok := c.items[slug]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(previewCacheItem).b, true
+}
+
+// add caches a file and drops the least recently used files which no longer fit. Files
+// larger than the cache are not cached at all.
+func (c *previewCache) add(slug string, b []byte) {
+	if len(b) > c.max {
+		return
+	}
+	if e, ok := c.items[slug]; ok {
+		c.size -= len(e.Value.(previewCacheItem).b)
+		c.order.Remove(e)
+	}
+	c.items[slug] = c.order.PushFront(previewCacheItem{slug: slug, b: b})
+	c.size += len(b)
+	for c.size > c.max {
+		e := c.order.Back()
+		item := c.order.Remove(e).(previewCacheItem)
+		delete(c.items, item.slug)
+		c.size -= len(item.b)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestPreviewCache(t *testing.T) {
+	c := newPreviewCache(10)
+	c.add("a", make([]byte, 4))
+	c.add("b", make([]byte, 4))
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.add("c", make([]byte, 4))
+	if _, ok := c.get("b"); ok {
+		t.Error("expected the least recently used file to be dropped")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("expected a recently used file to be kept")
+	}
+	c.add("huge", make([]byte, 11))
+	if _, ok := c.get("huge"); ok {
+		t.Error("expected a file larger than the cache to be skipped")
+	}
+	c.add("a", make([]byte, 6))
+	if c.size != 10 || c.order.Len() != 2 {
+		t.Errorf("expected replacing a file to update the size. got %d bytes in %d files", c.size, c.order.Len())
+	}
+}
+
+func TestPreviewPhotosOpen(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "a.jpg")
+	if err := ioutil.WriteFile(src, []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := newMemClient()
+	client.files["b.jpg"] = []byte("lake")
+	p := &previewPhotos{
+		client: client,
+		jobs: map[string]exportPhotoJob{
+			"a.jpg":       {filename: "a.jpg", size: state.PhotoSizeTypeOriginal, src: src},
+			"b.jpg":       {filename: "b.jpg"},
+			"missing.jpg": {filename: "missing.jpg"},
+		},
+		cache:      newPreviewCache(previewCacheSize),
+		watermarks: make(map[string]*media.WatermarkOptions),
+	}
+	if b, err := p.open(ctx, "a.jpg"); err != nil || string(b) != "local" {
+		t.Fatalf("expected the local original. got %q %v", b, err)
+	}
+	os.Remove(src)
+	if b, err := p.open(ctx, "a.jpg"); err != nil || string(b) != "local" {
+		t.Errorf("expected the local original to be cached. got %q %v", b, err)
+	}
+	if b, err := p.open(ctx, "b.jpg"); err != nil || string(b) != "lake" {
+		t.Errorf("expected the file to be downloaded from the lake. got %q %v", b, err)
+	}
+	for _, slug := range []string{"missing.jpg", "unknown.jpg"} {
+		if _, err := p.open(ctx, slug); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s not to exist. got %v", slug, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/urfave/cli/v2"
+)
+
+func themeList(c *cli.Context) error {
+	names, err := gallery.InstalledThemes()
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	prettyLog("All themes:")
+	for i, name := range names {
+		t, err := gallery.LoadTheme(c.String("templates-dir"), name)
+		if err != nil {
+			prettyError("%d. %s  %v", i+1, name, err)
+			continue
+		}
+		fmt.Print(prettyLogStr("%d. %s  %s  %s", i+1, t.Manifest.Name, t.Manifest.Version, t.Manifest.Description))
+	}
+	return nil
+}
+
+func themeInstall(c *cli.Context) error {
+	if err := rejectDryRun(c); err != nil {
+		return err
+	}
+	src := c.Args().Get(0)
+	if src == "" {
+		return fmtErr(errCodeMisc, errors.New("Provide a theme directory or archive to install"))
+	}
+	t, err := gallery.InstallTheme(src)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	prettyLog("%s %s has been installed. Use it with --theme=%s", t.Manifest.Name, t.Manifest.Version, t.Manifest.Name)
+	return nil
+}
+
+func themeValidate(c *cli.Context) error {
+	dir := c.Args().Get(0)
+	if dir == "" {
+		return fmtErr(errCodeMisc, errors.New("Provide a theme directory to validate"))
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	t, err := gallery.OpenTheme(os.DirFS(dir), "")
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	errs := t.Validate()
+	for _, err := range errs {
+		prettyError("%v", err)
+	}
+	if len(errs) > 0 {
+		return fmtErr(errCodeMisc, fmt.Errorf("%s is not a valid theme", dir))
+	}
+	prettyLog("%s %s is a valid theme", t.Manifest.Name, t.Manifest.Version)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+func workspaceSet(c *cli.Context) error {
+	ctx := context.Background()
+	p, err := getProvider(c.String("provider"))
+	if err != nil {
+		return fmtErr(errCodeUnknownProvider, nil)
+	}
+	client, err := p.NewClient(ctx, c)
+	if err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	st, err := provisionState(ctx, client)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("title") {
+		st.Workspace.Title = c.String("title")
+	}
+	if c.IsSet("robots") {
+		st.Workspace.Robots = ""
+		if c.String("robots") != "" {
+			b, err := ioutil.ReadFile(c.String("robots"))
+			if err != nil {
+				return fmtErr(errCodeMisc, err)
+			}
+			st.Workspace.Robots = string(b)
+		}
+	}
+	if c.IsSet("page-size") {
+		if c.Int("page-size") < 0 {
+			return fmtErr(errCodeMisc, errors.New("The page size can not be negative"))
+		}
+		st.Workspace.PageSize = c.Int("page-size")
+	}
+	if c.IsSet("theme") {
+		if c.String("theme") != "" {
+			if _, err := gallery.LoadTheme(c.String("templates-dir"), c.String("theme")); err != nil {
+				return fmtErr(errCodeMisc, err)
+			}
+		}
+		st.Workspace.Theme = c.String("theme")
+	}
+	if st.Workspace.ThemeSettings, err = state.ApplyThemeSettings(st.Workspace.ThemeSettings, c.StringSlice("setting")); err != nil {
+		return fmtErr(errCodeMisc, err)
+	}
+	var errs []error
+	exitCode := func() cli.ExitCoder {
+		s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+		s.Start()
+		defer s.Stop()
+		// Every album inherits the defaults so they all have to be regenerated.
+		if len(st.Albums) == 0 {
+			if st, err = gallery.CreateIndexTemplate(ctx, gallery.CreateIndexOptions{
+				TplDir: c.String("templates-dir"),
+				Client: client,
+				St:     st,
+				Force:  c.Bool("force-render"),
+			}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, album := range st.Albums {
+			var albumErrs []error
+			st, albumErrs = gallery.CreateTemplatesFromState(ctx, client, st, album, c.String("templates-dir"), "", c.Bool("force-render"))
+			errs = append(errs, albumErrs...)
+		}
+		if _, err := saveState(ctx, client, st); err != nil {
+			return err
+		}
+		return nil
+	}()
+	for _, err := range errs {
+		prettyError("Encountered error while regenerating html files: %s", err)
+	}
+	if exitCode == nil {
+		prettyLog("The workspace has been updated")
+	}
+	return exitCode
+}
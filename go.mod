@@ -1,10 +1,11 @@
 module github.com/psaia/imgd
 
-go 1.13
+go 1.16
 
 require (
 	cloud.google.com/go/storage v1.12.0
 	github.com/briandowns/spinner v1.12.0
+	github.com/buckket/go-blurhash v1.1.0
 	github.com/disintegration/imaging v1.6.2
 	github.com/fatih/color v1.10.0
 	github.com/google/uuid v1.1.2
@@ -12,7 +13,9 @@ require (
 	github.com/kr/pretty v0.1.0
 	github.com/lunixbochs/vtclean v1.0.0 // indirect
 	github.com/manifoldco/promptui v0.8.0
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/image v0.0.0-20201208152932-35266b937fa6
 	golang.org/x/net v0.0.0-20200904194848-62affa334b73
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 	golang.org/x/sys v0.0.0-20201113233024-12cec1faf1ba // indirect
@@ -0,0 +1,130 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+const (
+	// CatalogueFile lists the listed albums as JSON, next to index.html.
+	CatalogueFile = "albums.json"
+
+	// CatalogueVersion is bumped whenever a field of the catalogue changes or is removed.
+	// Fields may be added without bumping it.
+	CatalogueVersion = 1
+)
+
+// Catalogue is the published albums.json.
+type Catalogue struct {
+	Version int              `json:"version"`
+	Title   string           `json:"title,omitempty"`
+	Albums  []CatalogueAlbum `json:"albums"`
+}
+
+// CatalogueAlbum is an album as listed in albums.json. Photos is only filled in the JSON of
+// the album itself.
+type CatalogueAlbum struct {
+	Version     int              `json:"version,omitempty"`
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	URL         string           `json:"url"`
+	JSONURL     string           `json:"jsonUrl"`
+	FeedURL     string           `json:"feedUrl"`
+	Created     string           `json:"created,omitempty"`
+	Updated     string           `json:"updated,omitempty"`
+	Cover       string           `json:"cover,omitempty"`
+	PhotoCount  int              `json:"photoCount"`
+	Photos      []CataloguePhoto `json:"photos,omitempty"`
+}
+
+// CataloguePhoto is a photo in the JSON of an album. Metadata follows the privacy policy
+// of the album.
+type CataloguePhoto struct {
+	Hash        string                   `json:"hash"`
+	Name        string                   `json:"name"`
+	Caption     string                   `json:"caption,omitempty"`
+	URL         string                   `json:"url"`
+	Width       int                      `json:"width,omitempty"`
+	Height      int                      `json:"height,omitempty"`
+	Added       string                   `json:"added,omitempty"`
+	Metadata    media.Metadata           `json:"metadata"`
+	Placeholder media.Placeholder        `json:"placeholder"`
+	Sizes       map[string]CatalogueSize `json:"sizes"`
+}
+
+// CatalogueSize is a published file of a photo. The dimensions are left out when they are
+// unknown.
+type CatalogueSize struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// RenderCatalogue creates albums.json.
+func RenderCatalogue(bucketURL string, st state.State) ([]byte, error) {
+	c := Catalogue{
+		Version: CatalogueVersion,
+		Title:   st.Workspace.Title,
+		Albums:  make([]CatalogueAlbum, 0),
+	}
+	for _, a := range st.ListedAlbums() {
+		c.Albums = append(c.Albums, newCatalogueAlbum(bucketURL, st, a))
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// RenderAlbumCatalogue creates the JSON of an album with its photos. They link to the first
+// photo page of the theme.
+func RenderAlbumCatalogue(theme Theme, bucketURL string, a state.Album, st state.State) ([]byte, error) {
+	c := newCatalogueAlbum(bucketURL, st, a)
+	c.Version = CatalogueVersion
+	c.Photos = make([]CataloguePhoto, 0)
+	page := state.PhotoPageSize(theme.PhotoPages()[0])
+	for _, hash := range a.Photos {
+		p := st.GetPhoto(hash)
+		if p == nil {
+			return nil, fmt.Errorf("no photo found for hash in photos array: %s", hash)
+		}
+		w, h := p.Dimensions(state.PhotoSizeTypeOriginal)
+		photo := CataloguePhoto{
+			Hash:        p.Hash,
+			Name:        p.Name,
+			Caption:     p.Caption,
+			URL:         p.PublicURL(bucketURL, a, page),
+			Width:       w,
+			Height:      h,
+			Added:       isoTime(p.AddedTime()),
+			Metadata:    a.PublishedMetadata(p.Metadata),
+			Placeholder: p.Placeholder,
+			Sizes:       make(map[string]CatalogueSize),
+		}
+		for _, size := range state.GetPhotoSizeTypes() {
+			w, h := p.Dimensions(size)
+			photo.Sizes[string(size)] = CatalogueSize{URL: p.PublicURLRawInAlbum(bucketURL, a, size), Width: w, Height: h}
+		}
+		c.Photos = append(c.Photos, photo)
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+func newCatalogueAlbum(bucketURL string, st state.State, a state.Album) CatalogueAlbum {
+	c := CatalogueAlbum{
+		ID:          a.ID,
+		Name:        a.Name,
+		Description: a.Description,
+		URL:         a.PublicURL(bucketURL),
+		JSONURL:     a.CatalogueURL(bucketURL),
+		FeedURL:     a.FeedURL(bucketURL),
+		Created:     isoTime(a.CreatedTime()),
+		Updated:     isoTime(a.UpdatedTime()),
+		PhotoCount:  len(a.Photos),
+	}
+	if cover := st.AlbumCover(a); cover != nil {
+		c.Cover = cover.Hash
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+package gallery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestRenderCatalogue(t *testing.T) {
+	listed, unlisted := state.NewAlbum(), state.NewAlbum()
+	listed.Name = "listed"
+	unlisted.Name, unlisted.Unlisted = "unlisted", true
+	st := state.New().AddAlbum(listed).AddAlbum(unlisted)
+	b, err := RenderCatalogue("https://lake", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Catalogue
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != CatalogueVersion || len(c.Albums) != 1 || c.Albums[0].Name != "listed" {
+		t.Fatalf("expected only the listed album. got %+v", c)
+	}
+	if c.Albums[0].JSONURL != "https://lake/"+listed.ID+"/album.json" {
+		t.Errorf("unexpected album json url: %s", c.Albums[0].JSONURL)
+	}
+}
+
+func TestRenderAlbumCatalogue(t *testing.T) {
+	a := state.NewAlbum()
+	a.Privacy = state.PrivacyStripLocation
+	st := state.New().AddAlbum(a)
+	p := state.Photo{
+		Hash:      "a1",
+		Extension: "jpg",
+		Name:      "first",
+		Caption:   "At the beach",
+		Metadata:  media.Metadata{Width: 4000, Height: 3000, Model: "X100V", HasGPS: true, Latitude: 1, Longitude: 2},
+	}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	a = *st.GetAlbum(a.ID)
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := RenderAlbumCatalogue(*theme, "https://lake", a, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c CatalogueAlbum
+	if err := json.Unmarshal(b, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != CatalogueVersion || c.Cover != "a1" || len(c.Photos) != 1 {
+		t.Fatalf("unexpected album: %+v", c)
+	}
+	photo := c.Photos[0]
+	if photo.Caption != "At the beach" || photo.URL != "https://lake/"+a.ID+"/a1-large.html" || photo.Width != 4000 {
+		t.Errorf("unexpected photo: %+v", photo)
+	}
+	if photo.Metadata.HasGPS || photo.Metadata.Model != "X100V" {
+		t.Errorf("expected the location to be stripped. got %+v", photo.Metadata)
+	}
+	if large := photo.Sizes["large"]; large.URL != "https://lake/a1-large.jpg" || large.Width != 3500 || large.Height != 2625 {
+		t.Errorf("unexpected large size: %+v", large)
+	}
+}
@@ -0,0 +1,115 @@
+package gallery
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+// exportBaseURL is the lake url exported pages are rendered with before their links are made
+// relative. The .invalid domain never resolves, so it can't be part of anything else.
+const exportBaseURL = "https://imgd.invalid"
+
+// ExportOptions are the options of ExportSite.
+type ExportOptions struct {
+	St        state.State
+	TplDir    string
+	ThemeName string
+	// Write stores a file of the site by its slug, e.g. ALBUM_ID/page-2.html.
+	Write func(slug string, b []byte) error
+}
+
+// ExportSite renders the pages, theme assets and JSON files of every album for hosting
+// outside of the lake. Links are relative to the file they're in so the site works from any
+// directory, including file://. Unlisted albums are exported but left out of the index. Feeds,
+// the sitemap and robots.txt need absolute urls and are left out. The photos themselves are
+// written by the caller since they come from the lake or from local originals.
+func ExportSite(opts ExportOptions) []error {
+	st := opts.St
+	errs := make([]error, 0)
+	write := func(slug string, b []byte, err error) {
+		if err == nil {
+			err = opts.Write(slug, relativeLinks(b, slug))
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	themeName := func(name string) string {
+		if opts.ThemeName != "" {
+			return opts.ThemeName
+		}
+		return name
+	}
+	themes := make(map[string]*Theme)
+	loadTheme := func(name string) (*Theme, error) {
+		if t, ok := themes[name]; ok {
+			return t, nil
+		}
+		t, err := LoadTheme(opts.TplDir, name)
+		if err != nil {
+			return nil, err
+		}
+		themes[name] = t
+		files, err := t.StaticFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			b, err := fs.ReadFile(t.FS, path.Join(staticDir, file))
+			write(path.Join(t.StaticPrefix(), file), b, err)
+		}
+		return t, nil
+	}
+
+	theme, err := loadTheme(themeName(st.Workspace.Theme))
+	if err != nil {
+		return append(errs, err)
+	}
+	b, err := RenderIndexTemplate(*theme, exportBaseURL, st)
+	write("index.html", b, err)
+	b, err = RenderCatalogue(exportBaseURL, st)
+	write(CatalogueFile, b, err)
+	b, err = RenderSearchIndex(exportBaseURL, st)
+	write(SearchIndexFile, b, err)
+	if theme.HasSearch() {
+		b, err = RenderSearchTemplate(*theme, exportBaseURL, st)
+		write(SearchPageFile, b, err)
+	}
+
+	for _, a := range st.Albums {
+		t, err := loadTheme(themeName(st.AlbumTheme(a)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for page := 1; page <= st.AlbumPages(a); page++ {
+			b, err := RenderAlbumTemplate(*t, exportBaseURL, a, st, page)
+			write(a.PageSlug(page), b, err)
+		}
+		b, err := RenderAlbumCatalogue(*t, exportBaseURL, a, st)
+		write(a.CatalogueSlug(), b, err)
+		for _, hash := range a.Photos {
+			p := st.GetPhoto(hash)
+			if p == nil {
+				continue
+			}
+			for _, page := range t.PhotoPages() {
+				size := state.PhotoPageSize(page)
+				b, err := RenderPhotoTemplate(*t, exportBaseURL, st, a, *p, size)
+				write(p.PublicSlug(a, size), b, err)
+			}
+		}
+	}
+	return errs
+}
+
+// relativeLinks replaces the export base url in a file with the path back to the root of
+// the site.
+func relativeLinks(b []byte, slug string) []byte {
+	prefix := strings.Repeat("../", strings.Count(slug, "/"))
+	return bytes.ReplaceAll(b, []byte(exportBaseURL+"/"), []byte(prefix))
+}
@@ -0,0 +1,47 @@
+package gallery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestExportSite(t *testing.T) {
+	a := state.NewAlbum()
+	a.Name = "Wedding"
+	st := state.New().AddAlbum(a)
+	p := state.Photo{Hash: "a1", Extension: "jpg", Name: "first"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	errs := ExportSite(ExportOptions{
+		St: st,
+		Write: func(slug string, b []byte) error {
+			files[slug] = string(b)
+			return nil
+		},
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, slug := range []string{"index.html", a.PublicSlug(), a.ID + "/a1-large.html", a.CatalogueSlug(), SearchIndexFile, theme.StaticPrefix() + "/limpo.css"} {
+		if _, ok := files[slug]; !ok {
+			t.Errorf("expected %s to be exported", slug)
+		}
+	}
+	for slug, content := range files {
+		if strings.Contains(content, exportBaseURL) {
+			t.Errorf("expected every link in %s to be relative", slug)
+		}
+	}
+	if !strings.Contains(files[a.PublicSlug()], `href="index.html"`) {
+		t.Errorf("expected the album page to link to the index next to it")
+	}
+	if !strings.Contains(files[a.ID+"/a1-large.html"], `src="../a1-large.jpg"`) {
+		t.Errorf("expected the photo page to link one directory up. got %s", files[a.ID+"/a1-large.html"])
+	}
+}
@@ -0,0 +1,186 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"mime"
+	"sort"
+	"time"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+const (
+	// IndexFeedFile is the Atom feed of the whole workspace, next to index.html.
+	IndexFeedFile = "feed.xml"
+
+	// feedLength is the amount of photos in the feed of an album. Feed readers only care
+	// about what is new.
+	feedLength = 50
+
+	// defaultFeedAuthor is used when the workspace has no title since Atom requires an author.
+	defaultFeedAuthor = "imgd"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+	Content   *atomText  `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// RenderIndexFeed creates the Atom feed of the listed albums, the most recently updated first.
+func RenderIndexFeed(bucketURL string, st state.State) ([]byte, error) {
+	albums := st.ListedAlbums()
+	sort.SliceStable(albums, func(i, j int) bool {
+		return albums[i].UpdatedTime().After(albums[j].UpdatedTime())
+	})
+	feed := newFeed(st, fmt.Sprintf("%s/index.html", bucketURL), fmt.Sprintf("%s/%s", bucketURL, IndexFeedFile), st.Workspace.Title)
+	for _, a := range albums {
+		entry := atomEntry{
+			ID:        a.PublicURL(bucketURL),
+			Title:     a.Name,
+			Updated:   feedTime(a.UpdatedTime()),
+			Published: feedTime(a.CreatedTime()),
+			Links:     []atomLink{{Href: a.PublicURL(bucketURL), Rel: "alternate", Type: "text/html"}},
+			Summary:   a.Description,
+		}
+		if cover := st.AlbumCover(a); cover != nil {
+			entry.Links = append(entry.Links, enclosure(bucketURL, a, *cover))
+			entry.Content = imageContent(bucketURL, a, *cover)
+		}
+		feed.Entries = append(feed.Entries, entry)
+		if feed.Updated == "" {
+			feed.Updated = entry.Updated
+		}
+	}
+	return encodeFeed(feed)
+}
+
+// RenderAlbumFeed creates the Atom feed of an album with its most recently added photos
+// first. They link to the first photo page of the theme.
+func RenderAlbumFeed(theme Theme, bucketURL string, a state.Album, st state.State) ([]byte, error) {
+	photos := make([]state.Photo, 0)
+	for _, hash := range a.Photos {
+		if p := st.GetPhoto(hash); p != nil {
+			photos = append(photos, *p)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		return photos[i].AddedTime().After(photos[j].AddedTime())
+	})
+	if len(photos) > feedLength {
+		photos = photos[:feedLength]
+	}
+	feed := newFeed(st, a.PublicURL(bucketURL), a.FeedURL(bucketURL), a.Name)
+	feed.Updated = feedTime(a.UpdatedTime())
+	size := state.PhotoPageSize(theme.PhotoPages()[0])
+	for _, p := range photos {
+		// Photos added before the date was recorded are as old as the album.
+		added := p.AddedTime()
+		if added.IsZero() {
+			added = a.CreatedTime()
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        p.PublicURL(bucketURL, a, size),
+			Title:     p.Name,
+			Updated:   feedTime(added),
+			Published: feedTime(added),
+			Links: []atomLink{
+				{Href: p.PublicURL(bucketURL, a, size), Rel: "alternate", Type: "text/html"},
+				enclosure(bucketURL, a, p),
+			},
+			Content: imageContent(bucketURL, a, p),
+		})
+	}
+	return encodeFeed(feed)
+}
+
+func newFeed(st state.State, pageURL, feedURL, title string) atomFeed {
+	author := st.Workspace.Title
+	if author == "" {
+		author = defaultFeedAuthor
+	}
+	if title == "" {
+		title = author
+	}
+	return atomFeed{
+		ID:     feedURL,
+		Title:  title,
+		Author: atomAuthor{Name: author},
+		Links: []atomLink{
+			{Href: feedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: pageURL, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0),
+	}
+}
+
+// enclosure links to the medium size of a photo.
+func enclosure(bucketURL string, a state.Album, p state.Photo) atomLink {
+	return atomLink{
+		Href: p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeMedium),
+		Rel:  "enclosure",
+		Type: mime.TypeByExtension("." + p.Extension),
+	}
+}
+
+// imageContent shows the medium size of a photo in feed readers.
+func imageContent(bucketURL string, a state.Album, p state.Photo) *atomText {
+	return &atomText{
+		Type: "html",
+		Body: fmt.Sprintf(`<img src="%s" alt="%s">`, p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeMedium), template.HTMLEscapeString(p.Name)),
+	}
+}
+
+// feedTime formats a time for Atom. Atom requires a date so unknown times are the epoch.
+func feedTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func encodeFeed(feed atomFeed) ([]byte, error) {
+	if feed.Updated == "" {
+		feed.Updated = feedTime(time.Time{})
+	}
+	w := &bytes.Buffer{}
+	w.WriteString(xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package gallery
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestRenderAlbumFeed(t *testing.T) {
+	a := state.NewAlbum()
+	a.Name = "Wedding"
+	st := state.New().AddAlbum(a)
+	for _, p := range []state.Photo{
+		{Hash: "a1", Extension: "jpg", Name: "first", Added: "2021-01-01T10:00:00Z"},
+		{Hash: "b2", Extension: "jpg", Name: "second", Added: "2021-03-01T10:00:00Z"},
+	} {
+		st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	}
+	a = *st.GetAlbum(a.ID)
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := RenderAlbumFeed(*theme, "https://lake", a, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Wedding" || feed.Author.Name != defaultFeedAuthor || len(feed.Entries) != 2 {
+		t.Fatalf("unexpected feed: %+v", feed)
+	}
+	if feed.Entries[0].Title != "second" || feed.Entries[0].Updated != "2021-03-01T10:00:00Z" {
+		t.Errorf("expected the most recently added photo first. got %+v", feed.Entries[0])
+	}
+	links := feed.Entries[0].Links
+	if len(links) != 2 || links[0].Href != "https://lake/"+a.ID+"/b2-large.html" || links[1].Href != "https://lake/b2-medium.jpg" || links[1].Type != "image/jpeg" {
+		t.Errorf("expected links to the photo page and the medium size. got %+v", links)
+	}
+}
+
+func TestRenderIndexFeed(t *testing.T) {
+	older, newer := state.NewAlbum(), state.NewAlbum()
+	older.Name, older.Updated = "older", "2020-01-01T00:00:00Z"
+	newer.Name, newer.Updated = "newer", "2021-01-01T00:00:00Z"
+	st := state.New().AddAlbum(older).AddAlbum(newer)
+	st.Workspace.Title = "Jane's Photos"
+	b, err := RenderIndexFeed("https://lake", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Jane's Photos" || len(feed.Entries) != 2 || feed.Entries[0].Title != "newer" {
+		t.Fatalf("expected the most recently updated album first. got %+v", feed)
+	}
+	if feed.Updated != "2021-01-01T00:00:00Z" {
+		t.Errorf("expected the feed to be as recent as its newest album. got %s", feed.Updated)
+	}
+}
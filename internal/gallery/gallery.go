@@ -3,13 +3,17 @@ package gallery
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
-	"os"
 	"path"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/psaia/imgd/internal/media"
 	"github.com/psaia/imgd/internal/provider"
 	"github.com/psaia/imgd/internal/state"
 	"golang.org/x/sync/semaphore"
@@ -17,22 +21,117 @@ import (
 
 // IndexTplData is the struct which gets passed to RenderTemplate for the index page.
 type IndexTplData struct {
-	Albums []state.Album
+	Albums         []IndexAlbum
+	Settings       map[string]string
+	WorkspaceTitle string
+	// FeedURL is the Atom feed of the workspace.
+	FeedURL string
+	// SearchURL is the search page, empty when the theme has none.
+	SearchURL string
+	// NoIndex is never set on the index page. It exists so partials can be shared by
+	// every page.
+	NoIndex bool
+}
+
+// IndexAlbum is an album as it is listed on the index page.
+type IndexAlbum struct {
+	state.Album
+	URL        string
+	PhotoCount int
+	// Cover is nil for empty albums.
+	Cover     *state.Photo
+	CoverURL  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // PhotoTplData is the struct which gets passed to RenderTemplate for the photo page.
 type PhotoTplData struct {
-	Photo    state.Photo
-	Album    state.Album
+	Photo state.Photo
+	Album state.Album
+	// AlbumURL is the page of the album the photo is listed on.
 	AlbumURL string
-	Size     string
+	// Size is empty on responsive pages.
+	Size string
+	// PageURL is the URL of the page itself.
+	PageURL string
+	// FeedURL is the Atom feed of the album.
+	FeedURL string
+	// JSONLD is the ImageObject of the photo for a <script type="application/ld+json">.
+	JSONLD template.JS
+	// NoIndex asks search engines not to index the page since the album is unlisted.
+	NoIndex     bool
+	Metadata    media.Metadata
+	Placeholder media.Placeholder
+	Settings    map[string]string
+
+	// Prev and Next are nil for the first and last photo of the album. Their URLs link to
+	// the page of the same size.
+	Prev    *state.Photo
+	Next    *state.Photo
+	PrevURL string
+	NextURL string
+	// Index is the position of the photo in the album, starting at 1.
+	Index          int
+	Total          int
+	Cover          *state.Photo
+	Sizes          []SizeURL
+	AddedAt        time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WorkspaceTitle string
 }
 
-// AlbumTplData is the struct which gets passed to RenderTemplate for the album page.
+// SizeURL is the published file of a size of a photo. The dimensions are 0 when they
+// are unknown.
+type SizeURL struct {
+	Size    string
+	URL     string
+	PageURL string
+	Width   int
+	Height  int
+}
+
+// AlbumTplData is the struct which gets passed to RenderTemplate for a page of an album.
+// Photos only holds the photos of the page. The placeholders of each photo are available as
+// .Placeholder.
 type AlbumTplData struct {
 	Photos   []state.Photo
 	Album    state.Album
 	AlbumURL string
+	// IndexURL is the index page listing every album.
+	IndexURL string
+	// FeedURL is the Atom feed of the album.
+	FeedURL string
+	// JSONLD is the ImageGallery of the page for a <script type="application/ld+json">.
+	JSONLD template.JS
+	// NoIndex asks search engines not to index the page since the album is unlisted.
+	NoIndex  bool
+	Settings map[string]string
+	// Total is the amount of photos in the album, not on the page.
+	Total int
+
+	// Page starts at 1. PrevPageURL and NextPageURL are empty on the first and last page.
+	Page        int
+	Pages       int
+	PageLinks   []PageLink
+	PrevPageURL string
+	NextPageURL string
+
+	Cover *state.Photo
+	// CoverURL is the medium size of the cover, e.g. for og:image. It is empty for empty
+	// albums.
+	CoverURL       string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WorkspaceTitle string
+}
+
+// PageLink links to a page of an album.
+type PageLink struct {
+	Page    int
+	URL     string
+	Current bool
 }
 
 // CreateIndexOptions are options
@@ -41,6 +140,9 @@ type CreateIndexOptions struct {
 	Client    provider.Client
 	TplDir    string
 	ThemeName string
+	// Theme is rendered with instead of loading the theme by name when it is set.
+	Theme *Theme
+	Force bool
 }
 
 // CreateAlbumOptions are options
@@ -51,41 +153,120 @@ type CreateAlbumOptions struct {
 	Photo     state.Photo
 	TplDir    string
 	ThemeName string
+	// Theme is rendered with instead of loading the theme by name when it is set.
+	Theme *Theme
+	Force bool
 }
 
 // CreatePhotoOptions are options
 type CreatePhotoOptions struct {
+	St        state.State
 	Client    provider.Client
 	Album     state.Album
 	Photo     state.Photo
 	TplDir    string
 	ThemeName string
-	Size      state.PhotoSizeType
+	// Theme is rendered with instead of loading the theme by name when it is set.
+	Theme *Theme
+	Size  state.PhotoSizeType
+	Force bool
 }
 
 // CreateTemplatesFromState will generate and save all template files based on the state object.
-func CreateTemplatesFromState(ctx context.Context, client provider.Client, st state.State, album state.Album, tplDir, theme string) []error {
-	var mu sync.Mutex
+// The theme overrides the themes of the workspace and album when it isn't empty. Only pages
+// whose content changed since they were last uploaded are uploaded unless force is set.
+// Other albums which were last rendered with different photo pages, e.g. by a version of imgd
+// which rendered a page for every size, are rendered again once so their orphaned pages are
+// removed.
+func CreateTemplatesFromState(ctx context.Context, client provider.Client, st state.State, album state.Album, tplDir, theme string, force bool) (state.State, []error) {
 	errors := make([]error, 0)
-	maxWorkers := 10
-	sem := semaphore.NewWeighted(int64(maxWorkers))
-	if err := CreateIndexTemplate(ctx, CreateIndexOptions{
-		ThemeName: theme,
+	themeOf := func(a state.Album) string {
+		if theme != "" {
+			return theme
+		}
+		return st.AlbumTheme(a)
+	}
+	indexTheme := theme
+	if theme == "" {
+		indexTheme = st.Workspace.Theme
+	}
+	// Every theme is loaded once and shared by all pages of the render.
+	themes := make(map[string]*Theme)
+	loadErrs := make(map[string]error)
+	load := func(name string) (*Theme, error) {
+		if t, ok := themes[name]; ok {
+			return t, loadErrs[name]
+		}
+		t, err := LoadTheme(tplDir, name)
+		themes[name], loadErrs[name] = t, err
+		if err == nil {
+			var uploadErr error
+			if st, uploadErr = t.UploadStatic(ctx, client, st, force); uploadErr != nil {
+				errors = append(errors, uploadErr)
+			}
+		}
+		return t, err
+	}
+	if t, err := load(indexTheme); err != nil {
+		errors = append(errors, err)
+	} else if st, err = CreateIndexTemplate(ctx, CreateIndexOptions{
+		ThemeName: indexTheme,
+		Theme:     t,
 		TplDir:    tplDir,
 		Client:    client,
 		St:        st,
+		Force:     force,
 	}); err != nil {
 		errors = append(errors, err)
 	}
-	if err := CreateAlbumTemplate(ctx, CreateAlbumOptions{
-		ThemeName: theme,
+	others := make([]state.Album, 0, len(st.Albums))
+	for _, a := range st.Albums {
+		if a.ID != album.ID {
+			others = append(others, a)
+		}
+	}
+	if t, err := load(themeOf(album)); err != nil {
+		errors = append(errors, err)
+	} else {
+		var errs []error
+		st, errs = createAlbumTemplates(ctx, client, st, album, t, tplDir, force)
+		errors = append(errors, errs...)
+	}
+	for _, a := range others {
+		// Albums whose theme can't be loaded are left for their own sync to report.
+		t, err := load(themeOf(a))
+		if err != nil || samePages(a.PhotoPages, t.PhotoPages()) {
+			continue
+		}
+		var errs []error
+		st, errs = createAlbumTemplates(ctx, client, st, a, t, tplDir, force)
+		errors = append(errors, errs...)
+	}
+	return st, errors
+}
+
+// createAlbumTemplates uploads the pages of an album and the pages of its photos, and removes
+// the photo pages it no longer has.
+func createAlbumTemplates(ctx context.Context, client provider.Client, st state.State, album state.Album, t *Theme, tplDir string, force bool) (state.State, []error) {
+	var mu sync.Mutex
+	var err error
+	errors := make([]error, 0)
+	maxWorkers := 10
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+	if st, err = CreateAlbumTemplate(ctx, CreateAlbumOptions{
+		ThemeName: t.Manifest.Name,
+		Theme:     t,
 		TplDir:    tplDir,
 		Client:    client,
 		Album:     album,
 		St:        st,
+		Force:     force,
 	}); err != nil {
 		errors = append(errors, err)
 	}
+	// The photo pages are recorded once they are all uploaded since the state can't be
+	// written to while it is being read.
+	rendered := make(map[string]string)
 	for _, hash := range album.Photos {
 		if err := sem.Acquire(ctx, 1); err != nil {
 			break
@@ -94,19 +275,26 @@ func CreateTemplatesFromState(ctx context.Context, client provider.Client, st st
 			defer sem.Release(1)
 			p := st.GetPhoto(hash)
 			if p != nil {
-				for _, size := range state.GetPhotoSizeTypes() {
-					if err := CreatePhotoTemplate(ctx, CreatePhotoOptions{
+				for _, page := range t.PhotoPages() {
+					size := state.PhotoPageSize(page)
+					slug, pageHash, err := createPhotoTemplate(ctx, CreatePhotoOptions{
+						St:        st,
 						Client:    client,
 						Album:     album,
 						Photo:     *p,
 						Size:      size,
-						ThemeName: theme,
+						ThemeName: t.Manifest.Name,
+						Theme:     t,
 						TplDir:    tplDir,
-					}); err != nil {
-						mu.Lock()
+						Force:     force,
+					})
+					mu.Lock()
+					if err != nil {
 						errors = append(errors, err)
-						mu.Unlock()
+					} else {
+						rendered[slug] = pageHash
 					}
+					mu.Unlock()
 				}
 			}
 		}(hash)
@@ -114,92 +302,264 @@ func CreateTemplatesFromState(ctx context.Context, client provider.Client, st st
 	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
 		fmt.Printf("Failed to acquire semaphore: %v", err)
 	}
-	return errors
+	for slug, pageHash := range rendered {
+		st = st.SetRendered(slug, pageHash)
+	}
+	st, errs := removeOrphanedPhotoPages(ctx, client, st, album, t.PhotoPages())
+	return st, append(errors, errs...)
+}
+
+// samePages is true when an album was last rendered with the photo pages of a theme.
+func samePages(rendered, pages []string) bool {
+	if len(rendered) != len(pages) {
+		return false
+	}
+	for i := range pages {
+		if rendered[i] != pages[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// removeOrphanedPhotoPages removes the photo pages an album was last rendered with which
+// aren't rendered anymore, e.g. after switching themes, and records the pages it has now.
+func removeOrphanedPhotoPages(ctx context.Context, client provider.Client, st state.State, album state.Album, pages []string) (state.State, []error) {
+	errs := make([]error, 0)
+	current := state.PhotoPageSizes(pages)
+	for _, size := range album.PhotoPageSizes() {
+		orphaned := true
+		for _, s := range current {
+			orphaned = orphaned && s != size
+		}
+		if !orphaned {
+			continue
+		}
+		for _, hash := range album.Photos {
+			slug := state.Photo{Hash: hash}.PublicSlug(album, size)
+			if err := client.RemoveFile(ctx, slug); err != nil && !errors.Is(err, provider.ErrNotExist) {
+				errs = append(errs, err)
+				continue
+			}
+			st = st.RemoveRendered(slug)
+		}
+	}
+	if len(errs) == 0 {
+		if a := st.GetAlbum(album.ID); a != nil {
+			a.PhotoPages = pages
+			st = st.UpdateAlbum(*a)
+		}
+	}
+	return st, errs
+}
+
+// optionTheme returns the theme passed in the options of a page or loads it by name.
+func optionTheme(theme *Theme, tplDir, name string) (*Theme, error) {
+	if theme != nil {
+		return theme, nil
+	}
+	return LoadTheme(tplDir, name)
 }
 
-// CreateIndexTemplate will upload the corresponding template file for an album.
-func CreateIndexTemplate(ctx context.Context, opts CreateIndexOptions) error {
-	tplDir, err := TemplateBaseDir(opts.TplDir, opts.ThemeName)
+// CreateIndexTemplate will upload the corresponding template file for an album. Without a
+// theme name the theme of the workspace is used.
+func CreateIndexTemplate(ctx context.Context, opts CreateIndexOptions) (state.State, error) {
+	name := opts.ThemeName
+	if name == "" {
+		name = opts.St.Workspace.Theme
+	}
+	theme, err := optionTheme(opts.Theme, opts.TplDir, name)
 	if err != nil {
-		return err
+		return opts.St, err
 	}
-	html, err := RenderIndexTemplate(tplDir, opts.Client.GetLakeBaseURL(), opts.St)
+	html, err := RenderIndexTemplate(*theme, opts.Client.GetLakeBaseURL(), opts.St)
 	if err != nil {
-		return err
+		return opts.St, err
 	}
-	_, err = opts.Client.UploadFile(ctx, "index.html", bytes.NewReader(html))
+	st, err := publish(ctx, opts.Client, opts.St, "index.html", html, opts.Force)
 	if err != nil {
-		return err
+		return st, err
+	}
+	feed, err := RenderIndexFeed(opts.Client.GetLakeBaseURL(), st)
+	if err != nil {
+		return st, err
+	}
+	if st, err = publish(ctx, opts.Client, st, IndexFeedFile, feed, opts.Force); err != nil {
+		return st, err
+	}
+	catalogue, err := RenderCatalogue(opts.Client.GetLakeBaseURL(), st)
+	if err != nil {
+		return st, err
+	}
+	if st, err = publish(ctx, opts.Client, st, CatalogueFile, catalogue, opts.Force); err != nil {
+		return st, err
+	}
+	search, err := RenderSearchIndex(opts.Client.GetLakeBaseURL(), st)
+	if err != nil {
+		return st, err
+	}
+	if st, err = publish(ctx, opts.Client, st, SearchIndexFile, search, opts.Force); err != nil {
+		return st, err
+	}
+	if theme.HasSearch() {
+		page, err := RenderSearchTemplate(*theme, opts.Client.GetLakeBaseURL(), st)
+		if err != nil {
+			return st, err
+		}
+		if st, err = publish(ctx, opts.Client, st, SearchPageFile, page, opts.Force); err != nil {
+			return st, err
+		}
+	}
+	sitemap, err := RenderSitemap(opts.Client.GetLakeBaseURL(), st)
+	if err != nil {
+		return st, err
+	}
+	if st, err = publish(ctx, opts.Client, st, SitemapFile, sitemap, opts.Force); err != nil {
+		return st, err
 	}
-	return err
+	return publish(ctx, opts.Client, st, RobotsFile, RenderRobots(opts.Client.GetLakeBaseURL(), st), opts.Force)
 }
 
-// CreateAlbumTemplate will upload the corresponding template file for an album.
-func CreateAlbumTemplate(ctx context.Context, opts CreateAlbumOptions) error {
-	tplDir, err := TemplateBaseDir(opts.TplDir, opts.ThemeName)
+// CreateAlbumTemplate will upload the template files of every page of an album and remove
+// the pages left over from when the album was larger. Without a theme name the theme of the
+// album is used.
+func CreateAlbumTemplate(ctx context.Context, opts CreateAlbumOptions) (state.State, error) {
+	st := opts.St
+	name := opts.ThemeName
+	if name == "" {
+		name = st.AlbumTheme(opts.Album)
+	}
+	theme, err := optionTheme(opts.Theme, opts.TplDir, name)
 	if err != nil {
-		return err
+		return st, err
 	}
-	html, err := RenderAlbumTemplate(tplDir, opts.Client.GetLakeBaseURL(), opts.Album, opts.St)
+	pages := st.AlbumPages(opts.Album)
+	for page := 1; page <= pages; page++ {
+		html, err := RenderAlbumTemplate(*theme, opts.Client.GetLakeBaseURL(), opts.Album, st, page)
+		if err != nil {
+			return st, err
+		}
+		if st, err = publish(ctx, opts.Client, st, opts.Album.PageSlug(page), html, opts.Force); err != nil {
+			return st, err
+		}
+	}
+	feed, err := RenderAlbumFeed(*theme, opts.Client.GetLakeBaseURL(), opts.Album, st)
 	if err != nil {
-		return err
+		return st, err
+	}
+	if st, err = publish(ctx, opts.Client, st, opts.Album.FeedSlug(), feed, opts.Force); err != nil {
+		return st, err
 	}
-	_, err = opts.Client.UploadFile(ctx, opts.Album.PublicSlug(), bytes.NewReader(html))
+	catalogue, err := RenderAlbumCatalogue(*theme, opts.Client.GetLakeBaseURL(), opts.Album, st)
 	if err != nil {
-		return err
+		return st, err
 	}
-	return err
+	if st, err = publish(ctx, opts.Client, st, opts.Album.CatalogueSlug(), catalogue, opts.Force); err != nil {
+		return st, err
+	}
+	return RemoveAlbumPages(ctx, opts.Client, st, opts.Album, pages+1)
 }
 
-// CreatePhotoTemplate will upload the corresponding template for a photo.
-func CreatePhotoTemplate(ctx context.Context, opts CreatePhotoOptions) error {
-	tplDir, err := TemplateBaseDir(opts.TplDir, opts.ThemeName)
+// RemoveAlbumPages removes the pages of an album starting at a page, up to the first page the
+// state has no record of. Pages are paginated without gaps, so the recorded pages are all there is.
+func RemoveAlbumPages(ctx context.Context, client provider.Client, st state.State, a state.Album, from int) (state.State, error) {
+	for page := from; ; page++ {
+		slug := a.PageSlug(page)
+		if _, ok := st.Rendered[slug]; !ok {
+			return st, nil
+		}
+		if err := client.RemoveFile(ctx, slug); err != nil && !errors.Is(err, provider.ErrNotExist) {
+			return st, err
+		}
+		st = st.RemoveRendered(slug)
+	}
+}
+
+// CreatePhotoTemplate will upload the corresponding template for a photo. Without a theme
+// name the theme of the album is used.
+func CreatePhotoTemplate(ctx context.Context, opts CreatePhotoOptions) (state.State, error) {
+	slug, hash, err := createPhotoTemplate(ctx, opts)
 	if err != nil {
-		return err
+		return opts.St, err
+	}
+	return opts.St.SetRendered(slug, hash), nil
+}
+
+// createPhotoTemplate uploads the page of a photo without recording it in the state. It
+// returns the slug and RenderHash of the page.
+func createPhotoTemplate(ctx context.Context, opts CreatePhotoOptions) (string, string, error) {
+	name := opts.ThemeName
+	if name == "" {
+		name = opts.St.AlbumTheme(opts.Album)
 	}
-	html, err := RenderPhotoTemplate(tplDir, opts.ThemeName, opts.Client.GetLakeBaseURL(), opts.Album, opts.Photo, opts.Size)
+	theme, err := optionTheme(opts.Theme, opts.TplDir, name)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	_, err = opts.Client.UploadFile(ctx, opts.Photo.PublicSlug(opts.Album, opts.Size), bytes.NewReader(html))
+	html, err := RenderPhotoTemplate(*theme, opts.Client.GetLakeBaseURL(), opts.St, opts.Album, opts.Photo, opts.Size)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	return err
+	slug := opts.Photo.PublicSlug(opts.Album, opts.Size)
+	hash, err := uploadChanged(ctx, opts.Client, opts.St, slug, html, opts.Force)
+	return slug, hash, err
 }
 
-// TemplateBaseDir will return the
-func TemplateBaseDir(base, theme string) (string, error) {
-	if theme == "" {
-		theme = "limpo"
+// publish uploads a file unless it was last uploaded with the same content and records it in
+// the state.
+func publish(ctx context.Context, client provider.Client, st state.State, slug string, b []byte, force bool) (state.State, error) {
+	hash, err := uploadChanged(ctx, client, st, slug, b, force)
+	if err != nil {
+		return st, err
 	}
-	if base == "" {
-		base = "./templates"
+	return st.SetRendered(slug, hash), nil
+}
+
+// uploadChanged uploads a file unless it was last uploaded with the same content. It returns
+// the RenderHash of the file.
+func uploadChanged(ctx context.Context, client provider.Client, st state.State, slug string, b []byte, force bool) (string, error) {
+	hash := state.RenderHash(b)
+	if !force && !st.RenderChanged(slug, hash) {
+		return hash, nil
 	}
-	b, err := filepath.Abs(base)
-	if err != nil {
+	if _, err := client.UploadFile(ctx, slug, bytes.NewReader(b)); err != nil {
 		return "", err
 	}
-	fullPath := path.Join(b, theme)
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("template directory does not exist: %s", fullPath)
-	}
-	return fullPath, nil
+	return hash, nil
 }
 
 // RenderIndexTemplate will create the bytes.
-func RenderIndexTemplate(tplDir, bucketURL string, st state.State) ([]byte, error) {
-	t, err := template.New("index.tpl.html").Funcs(template.FuncMap{
-		"getAlbumURL": func(album state.Album) string {
-			return album.PublicURL(bucketURL)
-		},
-	}).ParseFiles(path.Join(tplDir, "index.tpl.html"))
+func RenderIndexTemplate(theme Theme, bucketURL string, st state.State) ([]byte, error) {
+	funcs := renderFuncs(bucketURL, state.Album{}, theme)
+	funcs["getAlbumURL"] = func(album publicURLer) string {
+		return album.PublicURL(bucketURL)
+	}
+	t, err := theme.parse(IndexTemplate, funcs)
 	if err != nil {
 		return nil, err
 	}
+	listed := st.ListedAlbums()
+	albums := make([]IndexAlbum, len(listed))
+	for idx, a := range listed {
+		albums[idx] = IndexAlbum{
+			Album:      a,
+			URL:        a.PublicURL(bucketURL),
+			PhotoCount: len(a.Photos),
+			Cover:      publishedPhoto(a, st.AlbumCover(a)),
+			CreatedAt:  a.CreatedTime(),
+			UpdatedAt:  a.UpdatedTime(),
+		}
+		if cover := albums[idx].Cover; cover != nil {
+			albums[idx].CoverURL = cover.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeThumbCropped)
+		}
+	}
 	w := &bytes.Buffer{}
 	if err := t.Execute(w, IndexTplData{
-		Albums: st.Albums,
+		Albums:         albums,
+		FeedURL:        fmt.Sprintf("%s/%s", bucketURL, IndexFeedFile),
+		SearchURL:      searchURL(theme, bucketURL),
+		Settings:       theme.settings(st.ThemeSettings(nil)),
+		WorkspaceTitle: st.Workspace.Title,
 	}); err != nil {
 		return nil, err
 	}
@@ -207,56 +567,209 @@ func RenderIndexTemplate(tplDir, bucketURL string, st state.State) ([]byte, erro
 }
 
 // RenderPhotoTemplate will create the bytes.
-func RenderPhotoTemplate(tplDir, theme, bucketURL string, a state.Album, p state.Photo, size state.PhotoSizeType) ([]byte, error) {
-	t, err := template.New("photo.tpl.html").Funcs(renderFuncs(bucketURL, a)).ParseFiles(path.Join(tplDir, "photo.tpl.html"))
+func RenderPhotoTemplate(theme Theme, bucketURL string, st state.State, a state.Album, p state.Photo, size state.PhotoSizeType) ([]byte, error) {
+	t, err := theme.parse(PhotoTemplate, renderFuncs(bucketURL, a, theme))
 	if err != nil {
 		return nil, err
 	}
+	p = a.PublishedPhoto(p)
+	data := PhotoTplData{
+		Photo:          p,
+		Size:           string(size),
+		PageURL:        p.PublicURL(bucketURL, a, size),
+		FeedURL:        a.FeedURL(bucketURL),
+		NoIndex:        a.Unlisted,
+		Album:          a,
+		AlbumURL:       a.PageURL(bucketURL, st.PhotoPage(a, p.Hash)),
+		Metadata:       p.Metadata,
+		Placeholder:    p.Placeholder,
+		Settings:       theme.settings(st.ThemeSettings(&a)),
+		Total:          len(a.Photos),
+		Cover:          publishedPhoto(a, st.AlbumCover(a)),
+		Sizes:          sizeURLs(theme, bucketURL, a, p),
+		AddedAt:        p.AddedTime(),
+		CreatedAt:      a.CreatedTime(),
+		UpdatedAt:      a.UpdatedTime(),
+		WorkspaceTitle: st.Workspace.Title,
+	}
+	for idx, hash := range a.Photos {
+		if hash != p.Hash {
+			continue
+		}
+		data.Index = idx + 1
+		if idx > 0 {
+			data.Prev = publishedPhoto(a, st.GetPhoto(a.Photos[idx-1]))
+		}
+		if idx < len(a.Photos)-1 {
+			data.Next = publishedPhoto(a, st.GetPhoto(a.Photos[idx+1]))
+		}
+		break
+	}
+	if data.Prev != nil {
+		data.PrevURL = data.Prev.PublicURL(bucketURL, a, size)
+	}
+	if data.Next != nil {
+		data.NextURL = data.Next.PublicURL(bucketURL, a, size)
+	}
+	if data.JSONLD, err = photoJSONLD(bucketURL, a, p, size); err != nil {
+		return nil, err
+	}
 	w := &bytes.Buffer{}
-	if err := t.Execute(w, PhotoTplData{
-		Photo:    p,
-		Size:     string(size),
-		Album:    a,
-		AlbumURL: a.PublicURL(bucketURL),
-	}); err != nil {
+	if err := t.Execute(w, data); err != nil {
 		return nil, err
 	}
 	return w.Bytes(), nil
 }
 
-// RenderAlbumTemplate will create the bytes.
-func RenderAlbumTemplate(tplDir, bucketURL string, a state.Album, st state.State) ([]byte, error) {
-	t, err := template.New("album.tpl.html").Funcs(renderFuncs(bucketURL, a)).ParseFiles(path.Join(tplDir, "album.tpl.html"))
+// publishedPhoto is the published version of an optional photo, see state.Album.PublishedPhoto.
+func publishedPhoto(a state.Album, p *state.Photo) *state.Photo {
+	if p == nil {
+		return nil
+	}
+	published := a.PublishedPhoto(*p)
+	return &published
+}
+
+// RenderAlbumTemplate will create the bytes of a page of an album, starting at page 1.
+func RenderAlbumTemplate(theme Theme, bucketURL string, a state.Album, st state.State, page int) ([]byte, error) {
+	t, err := theme.parse(AlbumTemplate, renderFuncs(bucketURL, a, theme))
 	if err != nil {
 		return nil, err
 	}
-	photoList := make([]state.Photo, len(a.Photos))
-	for idx, hash := range a.Photos {
+	hashes := st.AlbumPagePhotos(a, page)
+	photoList := make([]state.Photo, len(hashes))
+	for idx, hash := range hashes {
 		p := st.GetPhoto(hash)
 		if p == nil {
 			return nil, fmt.Errorf("no photo found for hash in photos array: %s", hash)
 		}
-		photoList[idx] = *p
+		photoList[idx] = a.PublishedPhoto(*p)
+	}
+	data := AlbumTplData{
+		Photos:         photoList,
+		Album:          a,
+		AlbumURL:       a.PublicURL(bucketURL),
+		IndexURL:       fmt.Sprintf("%s/index.html", bucketURL),
+		FeedURL:        a.FeedURL(bucketURL),
+		NoIndex:        a.Unlisted,
+		Settings:       theme.settings(st.ThemeSettings(&a)),
+		Total:          len(a.Photos),
+		Page:           page,
+		Pages:          st.AlbumPages(a),
+		Cover:          publishedPhoto(a, st.AlbumCover(a)),
+		CreatedAt:      a.CreatedTime(),
+		UpdatedAt:      a.UpdatedTime(),
+		WorkspaceTitle: st.Workspace.Title,
+	}
+	for p := 1; p <= data.Pages; p++ {
+		data.PageLinks = append(data.PageLinks, PageLink{Page: p, URL: a.PageURL(bucketURL, p), Current: p == page})
+	}
+	if page > 1 {
+		data.PrevPageURL = a.PageURL(bucketURL, page-1)
+	}
+	if page < data.Pages {
+		data.NextPageURL = a.PageURL(bucketURL, page+1)
+	}
+	if data.Cover != nil {
+		data.CoverURL = data.Cover.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeMedium)
+	}
+	if data.JSONLD, err = galleryJSONLD(bucketURL, a, photoList, state.PhotoPageSize(theme.PhotoPages()[0])); err != nil {
+		return nil, err
 	}
 	w := &bytes.Buffer{}
-	if err := t.Execute(w, AlbumTplData{
-		Photos:   photoList,
-		Album:    a,
-		AlbumURL: a.PublicURL(bucketURL),
-	}); err != nil {
+	if err := t.Execute(w, data); err != nil {
 		return nil, err
 	}
 	return w.Bytes(), nil
 }
 
-// renderFuncs are available to photo and album templates.
-func renderFuncs(bucketURL string, album state.Album) template.FuncMap {
+// publicURLer is anything with a page, e.g. state.Album and IndexAlbum.
+type publicURLer interface {
+	PublicURL(bucketURL string) string
+}
+
+// sizeURLs lists every published size of a photo.
+func sizeURLs(theme Theme, bucketURL string, a state.Album, p state.Photo) []SizeURL {
+	sizes := make([]SizeURL, 0)
+	for _, size := range state.GetPhotoSizeTypes() {
+		w, h := p.Dimensions(size)
+		s := SizeURL{
+			Size:   string(size),
+			URL:    p.PublicURLRawInAlbum(bucketURL, a, size),
+			Width:  w,
+			Height: h,
+		}
+		if theme.hasPhotoPage(size) {
+			s.PageURL = p.PublicURL(bucketURL, a, size)
+		}
+		sizes = append(sizes, s)
+	}
+	return sizes
+}
+
+// srcset lists the sizes of a photo which keep its aspect ratio by their width. Sizes with the
+// same width, e.g. because the photo is smaller than the size, are listed once. Without
+// known dimensions there is only the large size.
+func srcset(bucketURL string, a state.Album, p state.Photo, sizes []state.PhotoSizeType) template.Srcset {
+	type candidate struct {
+		url   string
+		width int
+	}
+	candidates := make([]candidate, 0)
+	widths := make(map[int]bool)
+	for _, size := range sizes {
+		w, _ := p.Dimensions(size)
+		if w == 0 || widths[w] {
+			continue
+		}
+		widths[w] = true
+		candidates = append(candidates, candidate{p.PublicURLRawInAlbum(bucketURL, a, size), w})
+	}
+	if len(candidates) == 0 {
+		return template.Srcset(p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeLarge))
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].width < candidates[j].width
+	})
+	parts := make([]string, len(candidates))
+	for idx, c := range candidates {
+		parts[idx] = fmt.Sprintf("%s %dw", c.url, c.width)
+	}
+	return template.Srcset(strings.Join(parts, ", "))
+}
+
+// renderFuncs are available to every template.
+func renderFuncs(bucketURL string, album state.Album, theme Theme) template.FuncMap {
 	return template.FuncMap{
+		"asset": func(file string) string {
+			return fmt.Sprintf("%s/%s", bucketURL, path.Join(theme.StaticPrefix(), file))
+		},
 		"getPhotoPublicURL": func(photo state.Photo, size string) string {
 			return photo.PublicURL(bucketURL, album, state.PhotoSizeType(size))
 		},
+		// getPhotoPageURL links to the first photo page of the theme.
+		"getPhotoPageURL": func(photo state.Photo) string {
+			return photo.PublicURL(bucketURL, album, state.PhotoPageSize(theme.PhotoPages()[0]))
+		},
 		"getPhotoRawURL": func(photo state.Photo, size string) string {
-			return photo.PublicURLRaw(bucketURL, state.PhotoSizeType(size))
+			return photo.PublicURLRawInAlbum(bucketURL, album, state.PhotoSizeType(size))
+		},
+		// getPhotoSrcset lists the sizes of a photo with their widths for the srcset attribute,
+		// e.g. {{getPhotoSrcset .Photo}} or {{getPhotoSrcset .Photo "small" "medium"}}.
+		"getPhotoSrcset": func(photo state.Photo, sizes ...string) template.Srcset {
+			return srcset(bucketURL, album, photo, theme.srcsetSizes(sizes))
+		},
+		// gridSizes is the sizes attribute of a photo in a grid of columns. Other values of
+		// columns, e.g. "auto", use the fallback, e.g. "125px".
+		"gridSizes": func(columns, fallback string) string {
+			if n, err := strconv.Atoi(columns); err == nil && n > 0 {
+				return fmt.Sprintf("calc(100vw / %d)", n)
+			}
+			return fallback
+		},
+		// html/template doesn't trust data URIs so they have to be marked safe.
+		"getPhotoLQIP": func(photo state.Photo) template.URL {
+			return template.URL(photo.Placeholder.LQIP)
 		},
 	}
 }
@@ -0,0 +1,296 @@
+package gallery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestLoadTheme(t *testing.T) {
+	st := state.New()
+	st = st.AddAlbum(state.NewAlbum())
+
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := RenderIndexTemplate(*theme, "https://lake", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "https://lake/") {
+		t.Fatalf("expected the bundled theme to render the album links")
+	}
+
+	dir, err := ioutil.TempDir("", "imgd-themes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "limpo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "limpo", "index.tpl.html"), []byte("{{len .Albums}} albums"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	theme, err = LoadTheme(dir, "limpo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html, err = RenderIndexTemplate(*theme, "https://lake", st); err != nil || string(html) != "1 albums" {
+		t.Fatalf("expected the theme on disk to override the bundled theme. got %q (%v)", html, err)
+	}
+	if _, err := LoadTheme(dir, "nope"); err == nil {
+		t.Fatalf("expected an unknown theme to be rejected")
+	}
+}
+
+func TestRenderPhotoTemplateNavigation(t *testing.T) {
+	a := state.NewAlbum()
+	st := state.New().AddAlbum(a)
+	for _, hash := range []string{"a1", "b2", "c3"} {
+		p := state.Photo{Hash: hash, Extension: "jpg", Name: hash}
+		st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	}
+	a = *st.GetAlbum(a.ID)
+	theme := &Theme{FS: fstest.MapFS{
+		PhotoTemplate: &fstest.MapFile{Data: []byte("{{.Index}}/{{.Total}} {{.Prev.Hash}} {{.Next.Hash}} {{len .Sizes}}")},
+	}}
+	html, err := RenderPhotoTemplate(*theme, "https://lake", st, a, *st.GetPhoto("b2"), state.PhotoSizeTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := fmt.Sprintf("2/3 a1 c3 %d", len(state.GetPhotoSizeTypes())); string(html) != expected {
+		t.Errorf("expected %q. got %q", expected, html)
+	}
+}
+
+func TestRenderPhotoTemplatePrivacy(t *testing.T) {
+	a := state.NewAlbum()
+	st := state.New().AddAlbum(a)
+	meta := media.Metadata{Model: "X100V", CaptureTime: "2020-11-15T10:30:00Z", Latitude: 37.77, Longitude: -122.41, HasGPS: true}
+	for _, hash := range []string{"a1", "b2"} {
+		p := state.Photo{Hash: hash, Extension: "jpg", Name: hash, Metadata: meta}
+		st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	}
+	a = *st.GetAlbum(a.ID)
+	theme := &Theme{FS: fstest.MapFS{
+		PhotoTemplate: &fstest.MapFile{Data: []byte("{{.Metadata.Camera}}|{{.Photo.Metadata.Latitude}}|{{.Prev.Metadata.Latitude}}|{{.Cover.Metadata.Latitude}}|{{.JSONLD}}")},
+		AlbumTemplate: &fstest.MapFile{Data: []byte("{{range .Photos}}{{.Metadata.Camera}}{{.Metadata.Latitude}}{{end}}")},
+	}}
+	html, err := RenderPhotoTemplate(*theme, "https://lake", st, a, *st.GetPhoto("b2"), state.PhotoSizeTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(html), "X100V") || strings.Contains(string(html), "37.77") || strings.Contains(string(html), "2020") {
+		t.Errorf("expected strip-all to publish no metadata. got %q", html)
+	}
+	if html, err = RenderAlbumTemplate(*theme, "https://lake", a, st, 1); err != nil || string(html) != "00" {
+		t.Errorf("expected the album page to publish no metadata. got %q (%v)", html, err)
+	}
+
+	a.Privacy = state.PrivacyStripLocation
+	if html, err = RenderPhotoTemplate(*theme, "https://lake", st, a, *st.GetPhoto("b2"), state.PhotoSizeTypeLarge); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "X100V") || strings.Contains(string(html), "37.77") {
+		t.Errorf("expected strip-location to publish the camera but not the location. got %q", html)
+	}
+}
+
+func TestRenderAlbumTemplatePages(t *testing.T) {
+	a := state.NewAlbum()
+	a.PageSize = 2
+	st := state.New().AddAlbum(a)
+	for _, hash := range []string{"a1", "b2", "c3"} {
+		p := state.Photo{Hash: hash, Extension: "jpg"}
+		st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	}
+	a = *st.GetAlbum(a.ID)
+	theme := &Theme{FS: fstest.MapFS{
+		AlbumTemplate: &fstest.MapFile{Data: []byte("{{.Page}}/{{.Pages}}{{range .Photos}} {{.Hash}}{{end}} {{.PrevPageURL}}")},
+	}}
+	html, err := RenderAlbumTemplate(*theme, "https://lake", a, st, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2/2 c3 " + a.PublicURL("https://lake"); string(html) != expected {
+		t.Errorf("expected %q. got %q", expected, html)
+	}
+}
+
+// fakeClient counts the uploaded files.
+type fakeClient struct {
+	provider.Client
+	uploads map[string]int
+	files   map[string]bool
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{uploads: make(map[string]int), files: make(map[string]bool)}
+}
+
+func (c *fakeClient) GetLakeBaseURL() string {
+	return "https://lake"
+}
+
+func (c *fakeClient) UploadFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	c.uploads[file]++
+	c.files[file] = true
+	return c.GetLakeBaseURL() + "/" + file, nil
+}
+
+func (c *fakeClient) RemoveFile(ctx context.Context, file string) error {
+	if !c.files[file] {
+		return provider.ErrNotExist
+	}
+	delete(c.files, file)
+	return nil
+}
+
+// recordingClient only records removals like a dry run, so removing never fails.
+type recordingClient struct {
+	*fakeClient
+	removed []string
+}
+
+func (c *recordingClient) RemoveFile(ctx context.Context, file string) error {
+	c.removed = append(c.removed, file)
+	return nil
+}
+
+func TestRemoveAlbumPagesStopsAtUnrenderedPage(t *testing.T) {
+	a := state.NewAlbum()
+	client := &recordingClient{fakeClient: newFakeClient()}
+	st := state.New()
+	for page := 1; page <= 3; page++ {
+		st = st.SetRendered(a.PageSlug(page), "hash")
+	}
+	st, err := RemoveAlbumPages(context.Background(), client, st, a, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.removed) != 2 || client.removed[0] != a.PageSlug(2) || client.removed[1] != a.PageSlug(3) {
+		t.Errorf("expected pages 2 and 3 to be removed. got %v", client.removed)
+	}
+	if _, ok := st.Rendered[a.PageSlug(1)]; !ok || len(st.Rendered) != 1 {
+		t.Errorf("expected only the first page to remain rendered. got %v", st.Rendered)
+	}
+}
+
+func TestCreateTemplatesFromStateUploadsChanges(t *testing.T) {
+	a := state.NewAlbum()
+	st := state.New().AddAlbum(a)
+	p := state.Photo{Hash: "a1", Extension: "jpg"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	a = *st.GetAlbum(a.ID)
+	client := newFakeClient()
+
+	st, errs := CreateTemplatesFromState(context.Background(), client, st, a, "", "", false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	first := len(client.uploads)
+	if first == 0 || client.uploads["index.html"] != 1 || client.uploads[p.PublicSlug(a, state.PhotoSizeTypeLarge)] != 1 {
+		t.Fatalf("expected every page to be uploaded. got %v", client.uploads)
+	}
+	st, _ = CreateTemplatesFromState(context.Background(), client, st, a, "", "", false)
+	for file, n := range client.uploads {
+		if n != 1 {
+			t.Errorf("expected %s to be skipped since it didn't change. uploaded %d times", file, n)
+		}
+	}
+
+	st.Workspace.Title = "Photos"
+	st, _ = CreateTemplatesFromState(context.Background(), client, st, a, "", "", false)
+	if client.uploads["index.html"] != 2 || client.uploads[a.PublicSlug()] != 2 {
+		t.Errorf("expected the pages showing the title to be uploaded again. got %v", client.uploads)
+	}
+
+	CreateTemplatesFromState(context.Background(), client, st, a, "", "", true)
+	if client.uploads[p.PublicSlug(a, state.PhotoSizeTypeLarge)] != 2 {
+		t.Errorf("expected force to upload every page. got %v", client.uploads)
+	}
+}
+
+func TestCreateTemplatesFromStateRemovesOrphanedPages(t *testing.T) {
+	a := state.NewAlbum()
+	st := state.New().AddAlbum(a)
+	p := state.Photo{Hash: "a1", Extension: "jpg"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	a = *st.GetAlbum(a.ID)
+	client := newFakeClient()
+	// Albums used to get a page for every size.
+	for _, size := range state.GetPhotoSizeTypes() {
+		client.files[p.PublicSlug(a, size)] = true
+	}
+
+	st, errs := CreateTemplatesFromState(context.Background(), client, st, a, "", "", false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, size := range state.GetPhotoSizeTypes() {
+		if exists := client.files[p.PublicSlug(a, size)]; exists != (size == state.PhotoSizeTypeLarge) {
+			t.Errorf("expected only the large page to be left. %s exists: %t", size, exists)
+		}
+	}
+	if pages := st.GetAlbum(a.ID).PhotoPages; len(pages) != 1 || pages[0] != "large" {
+		t.Errorf("expected the album to record its photo pages. got %v", pages)
+	}
+}
+
+func TestCreateTemplatesFromStateCleansUpOtherAlbums(t *testing.T) {
+	synced, legacy, current := state.NewAlbum(), state.NewAlbum(), state.NewAlbum()
+	current.PhotoPages = []string{"large"}
+	st := state.New().AddAlbum(synced).AddAlbum(legacy).AddAlbum(current)
+	p := state.Photo{Hash: "a1", Extension: "jpg"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(legacy, p).AddPhotoToAlbum(current, p)
+	legacy, current = *st.GetAlbum(legacy.ID), *st.GetAlbum(current.ID)
+	client := newFakeClient()
+	for _, size := range state.GetPhotoSizeTypes() {
+		client.files[p.PublicSlug(legacy, size)] = true
+	}
+
+	st, errs := CreateTemplatesFromState(context.Background(), client, st, *st.GetAlbum(synced.ID), "", "", false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, size := range state.GetPhotoSizeTypes() {
+		if exists := client.files[p.PublicSlug(legacy, size)]; exists != (size == state.PhotoSizeTypeLarge) {
+			t.Errorf("expected the orphaned pages of the other album to be removed. %s exists: %t", size, exists)
+		}
+	}
+	if pages := st.GetAlbum(legacy.ID).PhotoPages; len(pages) != 1 || pages[0] != "large" {
+		t.Errorf("expected the other album to record its photo pages. got %v", pages)
+	}
+	if client.uploads[current.PageSlug(1)] != 0 {
+		t.Error("expected albums rendered with the pages of their theme to be left alone")
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	a := state.NewAlbum()
+	theme := Theme{Manifest: Manifest{Sizes: []state.PhotoSizeType{state.PhotoSizeTypeThumbCropped, state.PhotoSizeTypeSmall, state.PhotoSizeTypeMedium, state.PhotoSizeTypeOriginal}}}
+	p := state.Photo{Hash: "a1", Extension: "jpg", Metadata: media.Metadata{Width: 1000, Height: 500}}
+	if s := srcset("https://lake", a, p, theme.srcsetSizes(nil)); s != "https://lake/a1-small.jpg 650w, https://lake/a1-medium.jpg 1000w" {
+		t.Errorf("expected the uncropped sizes the theme links to. got %s", s)
+	}
+	p.Metadata = media.Metadata{Width: 400, Height: 300}
+	if s := srcset("https://lake", a, p, theme.srcsetSizes([]string{"medium", "small"})); s != "https://lake/a1-medium.jpg 400w" {
+		t.Errorf("expected sizes of the same width to be listed once. got %s", s)
+	}
+	p.Metadata = media.Metadata{}
+	if s := srcset("https://lake", a, p, theme.srcsetSizes(nil)); s != "https://lake/a1-large.jpg" {
+		t.Errorf("expected the large size without known dimensions. got %s", s)
+	}
+}
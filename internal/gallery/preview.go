@@ -0,0 +1,235 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+// previewChangesPath answers with a signature of the theme files, which changes whenever
+// one of them is edited.
+const previewChangesPath = "/_imgd/changes"
+
+// previewReloadScript reloads a preview page once the theme files change.
+const previewReloadScript = `<script>
+(function() {
+    var last;
+    setInterval(function() {
+        fetch("` + previewChangesPath + `").then(function(res) { return res.text(); }).then(function(sig) {
+            if (last && sig !== last) { window.location.reload(); }
+            last = sig;
+        }).catch(function() {});
+    }, 1000);
+})();
+</script>`
+
+// errNotRendered is returned for files of the lake which aren't pages, e.g. photos.
+var errNotRendered = errors.New("not a rendered file")
+
+// PreviewOptions are the options of NewPreview.
+type PreviewOptions struct {
+	St        state.State
+	TplDir    string
+	ThemeName string
+	// BaseURL is where the preview is served, e.g. http://localhost:8080.
+	BaseURL string
+	// Open reads a file of the lake which isn't rendered, e.g. a size of a photo.
+	Open func(ctx context.Context, slug string) ([]byte, error)
+}
+
+// preview serves a gallery without uploading it.
+type preview struct {
+	opts PreviewOptions
+}
+
+// NewPreview serves the gallery of a state as it would be published to the lake. Pages are
+// rendered on every request and themes are read from disk every time, so pages reflect
+// edits to a theme right away and reload themselves when its files change.
+func NewPreview(opts PreviewOptions) http.Handler {
+	return preview{opts: opts}
+}
+
+// ServeHTTP implements http.Handler.
+func (p preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if slug == "" {
+		slug = "index.html"
+	}
+	if r.URL.Path == previewChangesPath {
+		sig, err := p.themeSignature()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, sig)
+		return
+	}
+	b, err := p.render(slug)
+	if errors.Is(err, errNotRendered) {
+		b, err = p.opts.Open(r.Context(), slug)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if path.Ext(slug) == ".html" {
+		b = injectReload(b)
+	}
+	if ct := mime.TypeByExtension(path.Ext(slug)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b)
+}
+
+// themeName is the theme a page is rendered with.
+func (p preview) themeName(name string) string {
+	if p.opts.ThemeName != "" {
+		return p.opts.ThemeName
+	}
+	return name
+}
+
+// render renders a file of the lake the way CreateTemplatesFromState would.
+func (p preview) render(slug string) ([]byte, error) {
+	st, base := p.opts.St, p.opts.BaseURL
+	if strings.HasPrefix(slug, "_themes/") {
+		return p.static(slug)
+	}
+	switch slug {
+	case "index.html", SearchPageFile:
+		theme, err := LoadTheme(p.opts.TplDir, p.themeName(st.Workspace.Theme))
+		if err != nil {
+			return nil, err
+		}
+		if slug == SearchPageFile {
+			if !theme.HasSearch() {
+				return nil, fs.ErrNotExist
+			}
+			return RenderSearchTemplate(*theme, base, st)
+		}
+		return RenderIndexTemplate(*theme, base, st)
+	case IndexFeedFile:
+		return RenderIndexFeed(base, st)
+	case CatalogueFile:
+		return RenderCatalogue(base, st)
+	case SearchIndexFile:
+		return RenderSearchIndex(base, st)
+	case SitemapFile:
+		return RenderSitemap(base, st)
+	case RobotsFile:
+		return RenderRobots(base, st), nil
+	}
+
+	id, file := slug, ""
+	if idx := strings.Index(slug, "/"); idx != -1 {
+		id, file = slug[:idx], slug[idx+1:]
+	}
+	a := st.GetAlbum(strings.TrimSuffix(id, ".html"))
+	if a == nil {
+		return nil, errNotRendered
+	}
+	theme, err := LoadTheme(p.opts.TplDir, p.themeName(st.AlbumTheme(*a)))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case file == "" && strings.HasSuffix(id, ".html"):
+		return RenderAlbumTemplate(*theme, base, *a, st, 1)
+	case file == "feed.xml":
+		return RenderAlbumFeed(*theme, base, *a, st)
+	case file == "album.json":
+		return RenderAlbumCatalogue(*theme, base, *a, st)
+	case strings.HasPrefix(file, "page-") && strings.HasSuffix(file, ".html"):
+		page, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(file, "page-"), ".html"))
+		if err != nil || page < 2 || page > st.AlbumPages(*a) {
+			return nil, fs.ErrNotExist
+		}
+		return RenderAlbumTemplate(*theme, base, *a, st, page)
+	case strings.HasSuffix(file, ".html"):
+		hash, size := strings.TrimSuffix(file, ".html"), ""
+		if idx := strings.Index(hash, "-"); idx != -1 {
+			hash, size = hash[:idx], hash[idx+1:]
+		}
+		photo := st.GetPhoto(hash)
+		if photo == nil || !a.HasPhoto(hash) || (size != "" && !state.ValidPhotoSizeType(state.PhotoSizeType(size))) {
+			return nil, fs.ErrNotExist
+		}
+		return RenderPhotoTemplate(*theme, base, st, *a, *photo, state.PhotoSizeType(size))
+	}
+	return nil, errNotRendered
+}
+
+// static reads a static file of a theme. The version in the path is ignored so edits show
+// up without bumping it.
+func (p preview) static(slug string) ([]byte, error) {
+	parts := strings.SplitN(slug, "/", 4)
+	if len(parts) != 4 {
+		return nil, fs.ErrNotExist
+	}
+	theme, err := LoadTheme(p.opts.TplDir, parts[1])
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	return fs.ReadFile(theme.FS, path.Join(staticDir, parts[3]))
+}
+
+// themeSignature sums up the modification times of the files of every theme in use.
+func (p preview) themeSignature() (string, error) {
+	names := []string{p.themeName(p.opts.St.Workspace.Theme)}
+	for _, a := range p.opts.St.Albums {
+		names = append(names, p.themeName(p.opts.St.AlbumTheme(a)))
+	}
+	sig := &bytes.Buffer{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		theme, err := LoadTheme(p.opts.TplDir, name)
+		if err != nil {
+			return "", err
+		}
+		err = fs.WalkDir(theme.FS, ".", func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(sig, "%s/%s:%d:%d\n", name, file, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return state.RenderHash(sig.Bytes()), nil
+}
+
+// injectReload adds previewReloadScript to the end of a page.
+func injectReload(b []byte) []byte {
+	idx := bytes.LastIndex(b, []byte("</body>"))
+	if idx == -1 {
+		return append(b, previewReloadScript...)
+	}
+	out := make([]byte, 0, len(b)+len(previewReloadScript))
+	out = append(out, b[:idx]...)
+	out = append(out, previewReloadScript...)
+	return append(out, b[idx:]...)
+}
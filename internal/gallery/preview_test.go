@@ -0,0 +1,53 @@
+package gallery
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestPreview(t *testing.T) {
+	a := state.NewAlbum()
+	st := state.New().AddAlbum(a)
+	p := state.Photo{Hash: "a1", Extension: "jpg", Name: "first"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(a, p)
+	handler := NewPreview(PreviewOptions{
+		St:      st,
+		BaseURL: "http://localhost:8080",
+		Open: func(ctx context.Context, slug string) ([]byte, error) {
+			if slug == "a1-large.jpg" {
+				return []byte("jpeg"), nil
+			}
+			return nil, fs.ErrNotExist
+		},
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	for _, path := range []string{"/", "/" + a.PublicSlug(), "/" + a.ID + "/a1-large.html", "/" + a.ID + "/a1.html"} {
+		w := get(path)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), previewChangesPath) {
+			t.Errorf("expected %s to be rendered with the reload script. got %d", path, w.Code)
+		}
+	}
+	if w := get("/a1-large.jpg"); w.Code != http.StatusOK || w.Body.String() != "jpeg" || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("expected the photo to be served. got %d %s", w.Code, w.Body.String())
+	}
+	if w := get("/" + a.ID + "/missing-large.html"); w.Code != http.StatusNotFound {
+		t.Errorf("expected pages of unknown photos to not exist. got %d", w.Code)
+	}
+	if w := get("/_themes/limpo/0/limpo.css"); w.Code != http.StatusOK {
+		t.Errorf("expected static files to be served regardless of the version. got %d", w.Code)
+	}
+	first, second := get(previewChangesPath).Body.String(), get(previewChangesPath).Body.String()
+	if first == "" || first != second {
+		t.Errorf("expected a stable signature while the theme doesn't change. got %q and %q", first, second)
+	}
+}
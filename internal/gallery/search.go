@@ -0,0 +1,133 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+const (
+	// SearchIndexFile is the search index of every listed album, next to index.html.
+	SearchIndexFile = "search.json"
+
+	// SearchTemplate is the page which searches the index. Themes don't have to provide it.
+	SearchTemplate = "search.tpl.html"
+
+	// SearchPageFile is where the search page of the workspace theme is published.
+	SearchPageFile = "search.html"
+)
+
+// SearchIndex is the published search.json. The keys of photos are kept short since there
+// is an entry for every photo of every listed album.
+type SearchIndex struct {
+	Albums []SearchAlbum `json:"albums"`
+	Photos []SearchPhoto `json:"photos"`
+}
+
+// SearchAlbum is an album in the search index.
+type SearchAlbum struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+}
+
+// SearchPhoto is a photo in the search index. Camera and date follow the privacy policy of
+// the album.
+type SearchPhoto struct {
+	// Album is the index of the album in SearchIndex.Albums.
+	Album   int      `json:"a"`
+	Name    string   `json:"n"`
+	Caption string   `json:"c,omitempty"`
+	Tags    []string `json:"t,omitempty"`
+	Camera  string   `json:"m,omitempty"`
+	// Date is when the photo was taken as YYYY-MM-DD.
+	Date string `json:"d,omitempty"`
+	// URL is the photo page and Thumbnail the cropped thumbnail.
+	URL       string `json:"u"`
+	Thumbnail string `json:"i"`
+}
+
+// SearchTplData is the data of the search page.
+type SearchTplData struct {
+	Settings       map[string]string
+	WorkspaceTitle string
+	IndexURL       string
+	SearchIndexURL string
+	FeedURL        string
+	// NoIndex is never set on the search page. It exists so partials can be shared by
+	// every page.
+	NoIndex bool
+}
+
+// RenderSearchIndex creates search.json. Photos link to the photo page their album page
+// links to.
+func RenderSearchIndex(bucketURL string, st state.State) ([]byte, error) {
+	index := SearchIndex{
+		Albums: make([]SearchAlbum, 0),
+		Photos: make([]SearchPhoto, 0),
+	}
+	for _, a := range st.ListedAlbums() {
+		index.Albums = append(index.Albums, SearchAlbum{
+			Name:        a.Name,
+			Description: a.Description,
+			URL:         a.PublicURL(bucketURL),
+		})
+		for _, hash := range a.Photos {
+			p := st.GetPhoto(hash)
+			if p == nil {
+				return nil, fmt.Errorf("no photo found for hash in photos array: %s", hash)
+			}
+			meta := a.PublishedMetadata(p.Metadata)
+			photo := SearchPhoto{
+				Album:     len(index.Albums) - 1,
+				Name:      p.Name,
+				Caption:   p.Caption,
+				Tags:      p.Tags,
+				Camera:    meta.Camera(),
+				URL:       p.PublicURL(bucketURL, a, a.PhotoLinkSize()),
+				Thumbnail: p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeThumbCropped),
+			}
+			if captured := meta.Captured(); !captured.IsZero() {
+				photo.Date = captured.Format("2006-01-02")
+			}
+			index.Photos = append(index.Photos, photo)
+		}
+	}
+	return json.Marshal(index)
+}
+
+// HasSearch reports whether the theme provides a search page.
+func (t Theme) HasSearch() bool {
+	_, err := fs.Stat(t.FS, SearchTemplate)
+	return err == nil
+}
+
+// RenderSearchTemplate creates the search page.
+func RenderSearchTemplate(theme Theme, bucketURL string, st state.State) ([]byte, error) {
+	t, err := theme.parse(SearchTemplate, renderFuncs(bucketURL, state.Album{}, theme))
+	if err != nil {
+		return nil, err
+	}
+	w := &bytes.Buffer{}
+	if err := t.Execute(w, SearchTplData{
+		Settings:       theme.settings(st.ThemeSettings(nil)),
+		WorkspaceTitle: st.Workspace.Title,
+		IndexURL:       fmt.Sprintf("%s/index.html", bucketURL),
+		SearchIndexURL: fmt.Sprintf("%s/%s", bucketURL, SearchIndexFile),
+		FeedURL:        fmt.Sprintf("%s/%s", bucketURL, IndexFeedFile),
+	}); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// searchURL is the search page when the theme has one.
+func searchURL(theme Theme, bucketURL string) string {
+	if !theme.HasSearch() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", bucketURL, SearchPageFile)
+}
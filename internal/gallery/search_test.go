@@ -0,0 +1,61 @@
+package gallery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestRenderSearchIndex(t *testing.T) {
+	listed, unlisted := state.NewAlbum(), state.NewAlbum()
+	listed.Name = "Beach"
+	unlisted.Name, unlisted.Unlisted = "Secret", true
+	st := state.New().AddAlbum(listed).AddAlbum(unlisted)
+	p := state.Photo{
+		Hash:      "a1",
+		Extension: "jpg",
+		Name:      "first",
+		Caption:   "Sunset",
+		Metadata:  media.Metadata{Model: "X100V", CaptureTime: "2021-06-01T19:00:00Z"},
+	}.Tag("dog")
+	st = st.PersistPhoto(p).AddPhotoToAlbum(listed, p).AddPhotoToAlbum(unlisted, p)
+	b, err := RenderSearchIndex("https://lake", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index SearchIndex
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Albums) != 1 || len(index.Photos) != 1 {
+		t.Fatalf("expected only the listed album. got %+v", index)
+	}
+	photo := index.Photos[0]
+	if photo.Caption != "Sunset" || strings.Join(photo.Tags, ",") != "dog" || photo.URL != "https://lake/"+listed.ID+"/a1-large.html" {
+		t.Errorf("unexpected photo: %+v", photo)
+	}
+	// The default privacy policy strips every piece of metadata.
+	if photo.Camera != "" || photo.Date != "" {
+		t.Errorf("expected the metadata to be stripped. got %+v", photo)
+	}
+}
+
+func TestRenderSearchTemplate(t *testing.T) {
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !theme.HasSearch() {
+		t.Fatal("expected the default theme to have a search page")
+	}
+	b, err := RenderSearchTemplate(*theme, "https://lake", state.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `data-index="https://lake/search.json"`) {
+		t.Errorf("expected the page to load the search index. got %s", b)
+	}
+}
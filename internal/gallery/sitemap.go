@@ -0,0 +1,86 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+const (
+	// SitemapFile lists every listed page for search engines, next to index.html.
+	SitemapFile = "sitemap.xml"
+
+	// RobotsFile tells search engines what to crawl and where the sitemap is.
+	RobotsFile = "robots.txt"
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	Image   string       `xml:"xmlns:image,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string         `xml:"loc"`
+	LastMod string         `xml:"lastmod,omitempty"`
+	Images  []sitemapImage `xml:"image:image"`
+}
+
+type sitemapImage struct {
+	Loc string `xml:"image:loc"`
+}
+
+// RenderSitemap lists the index page and every page of the listed albums and their photos.
+// Photo pages point to their large size as the image.
+func RenderSitemap(bucketURL string, st state.State) ([]byte, error) {
+	set := sitemapURLSet{
+		Image: "http://www.google.com/schemas/sitemap-image/1.1",
+		URLs:  []sitemapURL{{Loc: fmt.Sprintf("%s/index.html", bucketURL)}},
+	}
+	for _, a := range st.ListedAlbums() {
+		for page := 1; page <= st.AlbumPages(a); page++ {
+			set.URLs = append(set.URLs, sitemapURL{Loc: a.PageURL(bucketURL, page), LastMod: isoTime(a.UpdatedTime())})
+		}
+		for _, hash := range a.Photos {
+			p := st.GetPhoto(hash)
+			if p == nil {
+				continue
+			}
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:     p.PublicURL(bucketURL, a, a.PhotoLinkSize()),
+				LastMod: isoTime(p.AddedTime()),
+				Images:  []sitemapImage{{Loc: p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeLarge)}},
+			})
+		}
+	}
+	w := &bytes.Buffer{}
+	w.WriteString(xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// RenderRobots creates robots.txt. Unless the workspace has rules of its own everything
+// except the unlisted albums may be crawled. The sitemap is always linked.
+func RenderRobots(bucketURL string, st state.State) []byte {
+	rules := strings.TrimSpace(st.Workspace.Robots)
+	if rules == "" {
+		lines := []string{"User-agent: *"}
+		for _, a := range st.Albums {
+			if a.Unlisted {
+				lines = append(lines, fmt.Sprintf("Disallow: /%s", a.PublicSlug()), fmt.Sprintf("Disallow: /%s/", a.ID))
+			}
+		}
+		if len(lines) == 1 {
+			lines = append(lines, "Disallow:")
+		}
+		rules = strings.Join(lines, "\n")
+	}
+	return []byte(fmt.Sprintf("%s\n\nSitemap: %s/%s\n", rules, bucketURL, SitemapFile))
+}
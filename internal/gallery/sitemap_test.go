@@ -0,0 +1,50 @@
+package gallery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestRenderSitemap(t *testing.T) {
+	listed, unlisted := state.NewAlbum(), state.NewAlbum()
+	unlisted.Unlisted = true
+	st := state.New().AddAlbum(listed).AddAlbum(unlisted)
+	p := state.Photo{Hash: "a1", Extension: "jpg"}
+	st = st.PersistPhoto(p).AddPhotoToAlbum(listed, p).AddPhotoToAlbum(unlisted, p)
+	listed = *st.GetAlbum(listed.ID)
+
+	b, err := RenderSitemap("https://lake", st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitemap := string(b)
+	for _, expected := range []string{
+		"<loc>https://lake/index.html</loc>",
+		"<loc>" + listed.PublicURL("https://lake") + "</loc>",
+		"<loc>" + p.PublicURL("https://lake", listed, state.PhotoSizeTypeLarge) + "</loc>",
+		"<image:image>\n      <image:loc>https://lake/a1-large.jpg</image:loc>",
+	} {
+		if !strings.Contains(sitemap, expected) {
+			t.Errorf("expected the sitemap to contain %q. got:\n%s", expected, sitemap)
+		}
+	}
+	if strings.Contains(sitemap, unlisted.ID) {
+		t.Errorf("expected the unlisted album to be left out. got:\n%s", sitemap)
+	}
+}
+
+func TestRenderRobots(t *testing.T) {
+	unlisted := state.NewAlbum()
+	unlisted.Unlisted = true
+	st := state.New().AddAlbum(state.NewAlbum()).AddAlbum(unlisted)
+	robots := string(RenderRobots("https://lake", st))
+	if expected := "User-agent: *\nDisallow: /" + unlisted.PublicSlug() + "\nDisallow: /" + unlisted.ID + "/\n\nSitemap: https://lake/sitemap.xml\n"; robots != expected {
+		t.Errorf("expected %q. got %q", expected, robots)
+	}
+	st.Workspace.Robots = "User-agent: *\nDisallow: /\n"
+	if robots := string(RenderRobots("https://lake", st)); robots != "User-agent: *\nDisallow: /\n\nSitemap: https://lake/sitemap.xml\n" {
+		t.Errorf("expected the rules of the workspace. got %q", robots)
+	}
+}
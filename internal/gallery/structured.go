@@ -0,0 +1,96 @@
+package gallery
+
+import (
+	"encoding/json"
+	"html/template"
+	"time"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+const schemaContext = "https://schema.org"
+
+type imageGallery struct {
+	Context         string        `json:"@context"`
+	Type            string        `json:"@type"`
+	Name            string        `json:"name,omitempty"`
+	Description     string        `json:"description,omitempty"`
+	URL             string        `json:"url"`
+	DateCreated     string        `json:"dateCreated,omitempty"`
+	DateModified    string        `json:"dateModified,omitempty"`
+	AssociatedMedia []imageObject `json:"associatedMedia"`
+}
+
+type imageObject struct {
+	Context      string `json:"@context,omitempty"`
+	Type         string `json:"@type"`
+	Name         string `json:"name,omitempty"`
+	Caption      string `json:"caption,omitempty"`
+	URL          string `json:"url"`
+	ContentURL   string `json:"contentUrl"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	UploadDate   string `json:"uploadDate,omitempty"`
+	DateCreated  string `json:"dateCreated,omitempty"`
+}
+
+// galleryJSONLD is the ImageGallery of a page of an album with the photos on the page.
+func galleryJSONLD(bucketURL string, a state.Album, photos []state.Photo, size state.PhotoSizeType) (template.JS, error) {
+	g := imageGallery{
+		Context:         schemaContext,
+		Type:            "ImageGallery",
+		Name:            a.Name,
+		Description:     a.Description,
+		URL:             a.PublicURL(bucketURL),
+		DateCreated:     isoTime(a.CreatedTime()),
+		DateModified:    isoTime(a.UpdatedTime()),
+		AssociatedMedia: make([]imageObject, len(photos)),
+	}
+	for idx, p := range photos {
+		g.AssociatedMedia[idx] = newImageObject(bucketURL, a, p, size)
+	}
+	return marshalJSONLD(g)
+}
+
+// photoJSONLD is the ImageObject of a photo page.
+func photoJSONLD(bucketURL string, a state.Album, p state.Photo, size state.PhotoSizeType) (template.JS, error) {
+	o := newImageObject(bucketURL, a, p, size)
+	o.Context = schemaContext
+	return marshalJSONLD(o)
+}
+
+// newImageObject describes the large size of a photo on a page of the given size.
+func newImageObject(bucketURL string, a state.Album, p state.Photo, size state.PhotoSizeType) imageObject {
+	w, h := p.Dimensions(state.PhotoSizeTypeLarge)
+	return imageObject{
+		Type:         "ImageObject",
+		Name:         p.Name,
+		Caption:      p.Caption,
+		URL:          p.PublicURL(bucketURL, a, size),
+		ContentURL:   p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeLarge),
+		ThumbnailURL: p.PublicURLRawInAlbum(bucketURL, a, state.PhotoSizeTypeThumb),
+		Width:        w,
+		Height:       h,
+		UploadDate:   isoTime(p.AddedTime()),
+		DateCreated:  isoTime(a.PublishedMetadata(p.Metadata).Captured()),
+	}
+}
+
+// marshalJSONLD encodes structured data for a <script type="application/ld+json"> block.
+// json.Marshal escapes <, > and & so it can't close the script.
+func marshalJSONLD(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(b), nil
+}
+
+// isoTime formats a time for structured data and sitemaps. Unknown times are left out.
+func isoTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,34 @@
+package gallery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestGalleryJSONLD(t *testing.T) {
+	a := state.NewAlbum()
+	a.Name = "</script>"
+	p := state.Photo{Hash: "a1", Extension: "jpg", Metadata: media.Metadata{Width: 4000, Height: 2000}}
+	js, err := galleryJSONLD("https://lake", a, []state.Photo{p}, state.PhotoSizeTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g imageGallery
+	if err := json.Unmarshal([]byte(js), &g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Type != "ImageGallery" || g.Name != "</script>" || len(g.AssociatedMedia) != 1 {
+		t.Fatalf("unexpected gallery: %+v", g)
+	}
+	if o := g.AssociatedMedia[0]; o.ContentURL != "https://lake/a1-large.jpg" || o.Width != 3500 || o.Height != 1750 {
+		t.Errorf("expected the large size of the photo. got %+v", o)
+	}
+	for _, c := range string(js) {
+		if c == '<' {
+			t.Fatalf("expected < to be escaped so the script can't be closed. got %s", js)
+		}
+	}
+}
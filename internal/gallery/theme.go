@@ -0,0 +1,476 @@
+package gallery
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"github.com/psaia/imgd/templates"
+)
+
+// ManifestFile describes a theme. It lives in the root of the theme directory.
+const ManifestFile = "theme.json"
+
+// Page templates which every theme has to provide.
+const (
+	IndexTemplate = "index.tpl.html"
+	AlbumTemplate = "album.tpl.html"
+	PhotoTemplate = "photo.tpl.html"
+)
+
+const (
+	// partialsPattern matches the partials and layouts shared by every page of a theme.
+	partialsPattern = "partials/*.tpl.html"
+
+	// staticDir contains the CSS, JS and fonts of a theme.
+	staticDir = "static"
+)
+
+var themeNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Manifest is the theme.json of a theme.
+type Manifest struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	// Templates the theme requires besides the page templates, e.g. partials.
+	Templates []string `json:"templates,omitempty"`
+	// Sizes of each photo the theme links to.
+	Sizes []state.PhotoSizeType `json:"sizes,omitempty"`
+	// PhotoPages are the sizes which get a photo page, or state.PhotoPageResponsive for a
+	// single page per photo. Every size gets a page when it is empty.
+	PhotoPages []string `json:"photoPages,omitempty"`
+	// Settings the theme supports with their defaults. Workspaces and albums can override them.
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// Theme is a loaded theme package.
+type Theme struct {
+	Manifest Manifest
+	FS       fs.FS
+}
+
+// ThemesDir is where `imgd theme install` puts themes.
+func ThemesDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "imgd", "themes"), nil
+}
+
+// LoadTheme finds a theme by name. A theme within the base directory overrides an installed
+// theme of the same name, which in turn overrides a bundled theme. Names are checked like
+// those of installed themes so they can't reach outside of the theme directories.
+func LoadTheme(base, name string) (*Theme, error) {
+	if name == "" {
+		name = templates.DefaultTheme
+	}
+	if !themeNameRe.MatchString(name) {
+		return nil, fmt.Errorf("theme names are lowercase letters, numbers, dashes and underscores. got %q", name)
+	}
+	dirs := make([]string, 0)
+	if base != "" {
+		b, err := filepath.Abs(base)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, b)
+	}
+	if installed, err := ThemesDir(); err == nil {
+		dirs = append(dirs, installed)
+	}
+	for _, dir := range dirs {
+		fullPath := filepath.Join(dir, name)
+		if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+			return OpenTheme(os.DirFS(fullPath), name)
+		}
+	}
+	bundled, err := fs.Sub(templates.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(bundled, "."); err != nil {
+		if base != "" {
+			return nil, fmt.Errorf("theme does not exist: %s", filepath.Join(base, name))
+		}
+		return nil, fmt.Errorf("theme does not exist: %s", name)
+	}
+	return OpenTheme(bundled, name)
+}
+
+// OpenTheme reads the manifest of a theme. Themes from before manifests existed are
+// given one based on their directory name.
+func OpenTheme(fsys fs.FS, name string) (*Theme, error) {
+	b, err := fs.ReadFile(fsys, ManifestFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Theme{Manifest: Manifest{Name: name}, FS: fsys}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ManifestFile, err)
+	}
+	return &Theme{Manifest: m, FS: fsys}, nil
+}
+
+// settings are the defaults of the theme with the overrides applied.
+func (t Theme) settings(overrides map[string]string) map[string]string {
+	settings := make(map[string]string)
+	for k, v := range t.Manifest.Settings {
+		settings[k] = v
+	}
+	for k, v := range overrides {
+		settings[k] = v
+	}
+	return settings
+}
+
+// StaticPrefix is where the static files of the theme are published in the lake. The
+// version is part of it so browsers never use the files of an older version.
+func (t Theme) StaticPrefix() string {
+	version := t.Manifest.Version
+	if version == "" {
+		version = "0"
+	}
+	return path.Join("_themes", t.Manifest.Name, version)
+}
+
+// StaticFiles lists the files within the static directory, relative to it.
+func (t Theme) StaticFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := fs.WalkDir(t.FS, staticDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == staticDir {
+			return fs.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, strings.TrimPrefix(p, staticDir+"/"))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// UploadStatic publishes the static files of the theme which changed since they were last
+// uploaded, or all of them when force is set.
+func (t Theme) UploadStatic(ctx context.Context, client provider.Client, st state.State, force bool) (state.State, error) {
+	files, err := t.StaticFiles()
+	if err != nil {
+		return st, err
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(t.FS, path.Join(staticDir, file))
+		if err != nil {
+			return st, err
+		}
+		if st, err = publish(ctx, client, st, path.Join(t.StaticPrefix(), file), b, force); err != nil {
+			return st, err
+		}
+	}
+	return st, nil
+}
+
+// PhotoPages are the photo pages the theme is rendered with. The first one is what the
+// album page links to.
+func (t Theme) PhotoPages() []string {
+	if len(t.Manifest.PhotoPages) > 0 {
+		return t.Manifest.PhotoPages
+	}
+	pages := make([]string, 0)
+	for _, size := range state.GetPhotoSizeTypes() {
+		pages = append(pages, string(size))
+	}
+	return pages
+}
+
+// srcsetSizes are the sizes srcsets are made of. Without a choice of sizes these are the
+// sizes the theme links to which aren't cropped. The original is left out unless it is
+// chosen since it can be huge.
+func (t Theme) srcsetSizes(chosen []string) []state.PhotoSizeType {
+	sizes := make([]state.PhotoSizeType, 0)
+	for _, size := range chosen {
+		sizes = append(sizes, state.PhotoSizeType(size))
+	}
+	if len(sizes) > 0 {
+		return sizes
+	}
+	sizes = t.Manifest.Sizes
+	if len(sizes) == 0 {
+		sizes = state.GetPhotoSizeTypes()
+	}
+	fill := make(map[state.PhotoSizeType]bool)
+	for _, size := range state.GetFillPhotoSizeTypes() {
+		fill[size] = true
+	}
+	fit := make([]state.PhotoSizeType, 0)
+	for _, size := range sizes {
+		if !fill[size] && size != state.PhotoSizeTypeOriginal {
+			fit = append(fit, size)
+		}
+	}
+	return fit
+}
+
+// hasPhotoPage reports whether the theme renders a page for a size.
+func (t Theme) hasPhotoPage(size state.PhotoSizeType) bool {
+	for _, page := range t.PhotoPages() {
+		if state.PhotoPageSize(page) == size {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses a page template along with the partials of the theme.
+func (t Theme) parse(page string, funcs template.FuncMap) (*template.Template, error) {
+	patterns := []string{page}
+	if partials, err := fs.Glob(t.FS, partialsPattern); err != nil {
+		return nil, err
+	} else if len(partials) > 0 {
+		patterns = append(patterns, partialsPattern)
+	}
+	return template.New(page).Funcs(funcs).ParseFS(t.FS, patterns...)
+}
+
+// Validate returns every problem with a theme package.
+func (t Theme) Validate() []error {
+	errs := make([]error, 0)
+	if _, err := fs.Stat(t.FS, ManifestFile); err != nil {
+		errs = append(errs, fmt.Errorf("%s is missing", ManifestFile))
+	}
+	if !themeNameRe.MatchString(t.Manifest.Name) {
+		errs = append(errs, fmt.Errorf("name must be lowercase letters, numbers, dashes and underscores. got %q", t.Manifest.Name))
+	}
+	if t.Manifest.Version == "" {
+		errs = append(errs, errors.New("version is missing"))
+	}
+	for _, size := range t.Manifest.Sizes {
+		if !state.ValidPhotoSizeType(size) {
+			errs = append(errs, fmt.Errorf("unknown size: %s", size))
+		}
+	}
+	for _, page := range t.Manifest.PhotoPages {
+		if !state.ValidPhotoPage(page) {
+			errs = append(errs, fmt.Errorf("unknown photo page: %s", page))
+		}
+	}
+	for _, file := range t.Manifest.Templates {
+		if _, err := fs.Stat(t.FS, file); err != nil {
+			errs = append(errs, fmt.Errorf("required template is missing: %s", file))
+		}
+	}
+	funcs := renderFuncs("", state.Album{}, t)
+	funcs["getAlbumURL"] = func(publicURLer) string { return "" }
+	for _, page := range []string{IndexTemplate, AlbumTemplate, PhotoTemplate} {
+		if _, err := fs.Stat(t.FS, page); err != nil {
+			errs = append(errs, fmt.Errorf("page template is missing: %s", page))
+		} else if _, err := t.parse(page, funcs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if t.HasSearch() {
+		if _, err := t.parse(SearchTemplate, funcs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// InstalledThemes lists the names of the bundled and installed themes.
+func InstalledThemes() ([]string, error) {
+	names := make(map[string]bool)
+	bundled, err := fs.ReadDir(templates.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range bundled {
+		if entry.IsDir() {
+			names[entry.Name()] = true
+		}
+	}
+	if dir, err := ThemesDir(); err == nil {
+		installed, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, info := range installed {
+			if info.IsDir() {
+				names[info.Name()] = true
+			}
+		}
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// InstallTheme validates a theme from a directory, .zip or .tar.gz archive and copies it
+// into the themes directory.
+func InstallTheme(src string) (*Theme, error) {
+	fsys, cleanup, err := openThemeSource(src)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	t, err := OpenTheme(fsys, "")
+	if err != nil {
+		return nil, err
+	}
+	if errs := t.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid theme: %v", errs[0])
+	}
+	dir, err := ThemesDir()
+	if err != nil {
+		return nil, err
+	}
+	dst := filepath.Join(dir, t.Manifest.Name)
+	if err := os.RemoveAll(dst); err != nil {
+		return nil, err
+	}
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(p))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, b, 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return OpenTheme(os.DirFS(dst), t.Manifest.Name)
+}
+
+// openThemeSource returns the root of a theme, which is the directory containing the
+// manifest. Archives are extracted to a temporary directory which cleanup removes.
+func openThemeSource(src string) (fs.FS, func(), error) {
+	cleanup := func() {}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	root := src
+	if !info.IsDir() {
+		tmp, err := ioutil.TempDir("", "imgd-theme")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(tmp) }
+		switch {
+		case strings.HasSuffix(src, ".zip"):
+			err = extractZip(src, tmp)
+		case strings.HasSuffix(src, ".tar.gz") || strings.HasSuffix(src, ".tgz"):
+			err = extractTarGz(src, tmp)
+		default:
+			err = fmt.Errorf("unsupported theme archive: %s", src)
+		}
+		if err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		root = tmp
+	}
+	// Archives usually wrap the theme in a directory of its own.
+	matches, err := fs.Glob(os.DirFS(root), "*/"+ManifestFile)
+	if _, statErr := os.Stat(filepath.Join(root, ManifestFile)); statErr != nil && err == nil && len(matches) == 1 {
+		root = filepath.Join(root, path.Dir(matches[0]))
+	}
+	return os.DirFS(root), cleanup, nil
+}
+
+func extractZip(src, dst string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(dst, f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if err := extractFile(dst, hdr.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractFile writes a file from an archive, refusing paths which escape dst.
+func extractFile(dst, name string, r io.Reader) error {
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return fmt.Errorf("invalid path in theme archive: %s", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	w, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
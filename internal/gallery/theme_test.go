@@ -0,0 +1,106 @@
+package gallery
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestBundledThemeIsValid(t *testing.T) {
+	theme, err := LoadTheme("", "limpo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := theme.Validate(); len(errs) > 0 {
+		t.Fatalf("expected limpo to be valid. got %v", errs)
+	}
+	files, err := theme.StaticFiles()
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected limpo to have static files. got %v (%v)", files, err)
+	}
+	html, err := RenderIndexTemplate(*theme, "https://lake", state.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "https://lake/_themes/limpo/"+theme.Manifest.Version+"/limpo.css") {
+		t.Fatalf("expected the stylesheet to be linked under the versioned prefix. got %s", html)
+	}
+}
+
+func TestInstallTheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgd-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	archive := filepath.Join(dir, "dark.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	files := map[string]string{
+		"dark/theme.json":              `{"name": "dark", "version": "2.0.0", "sizes": ["large"]}`,
+		"dark/index.tpl.html":          `{{template "head"}}index`,
+		"dark/album.tpl.html":          `{{template "head"}}album`,
+		"dark/photo.tpl.html":          `{{template "head"}}photo`,
+		"dark/partials/head.tpl.html":  `{{define "head"}}<link href="{{asset "dark.css"}}">{{end}}`,
+		"dark/static/dark.css":         `body { background: #000; }`,
+		"dark/static/fonts/inter.woff": `font`,
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	theme, err := InstallTheme(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Manifest.Name != "dark" || theme.StaticPrefix() != "_themes/dark/2.0.0" {
+		t.Fatalf("unexpected theme: %+v", theme.Manifest)
+	}
+	static, _ := theme.StaticFiles()
+	if len(static) != 2 || static[1] != "fonts/inter.woff" {
+		t.Fatalf("expected the static files to be installed. got %v", static)
+	}
+	names, err := InstalledThemes()
+	if err != nil || len(names) != 2 || names[0] != "dark" {
+		t.Fatalf("expected dark to be installed next to limpo. got %v (%v)", names, err)
+	}
+	if _, err := LoadTheme("", "dark"); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := filepath.Join(dir, "invalid")
+	os.MkdirAll(invalid, 0755)
+	ioutil.WriteFile(filepath.Join(invalid, "theme.json"), []byte(`{"name": "Not Valid"}`), 0644)
+	if _, err := InstallTheme(invalid); err == nil {
+		t.Fatalf("expected an invalid theme to be rejected")
+	}
+}
+
+func TestLoadThemeRejectsPaths(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "nested", "escape"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../../etc", "nested/escape", "/etc", "..", "Limpo"} {
+		if _, err := LoadTheme(filepath.Join(base, "themes"), name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
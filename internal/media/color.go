@@ -0,0 +1,409 @@
+package media
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+var iccHeader = []byte("ICC_PROFILE\x00")
+
+var (
+	// errLookupProfile is returned for tone curves which aren't supported, e.g. lookup tables.
+	errLookupProfile = errors.New("icc profile can't be converted")
+	// errDegenerateProfile is returned for profiles whose colorants or curves can't produce
+	// colors, e.g. a singular matrix or parameters which aren't finite.
+	errDegenerateProfile = errors.New("icc profile is degenerate")
+)
+
+// The colorants of the sRGB profile, adapted to the D50 illuminant of the ICC PCS.
+var srgbColorants = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// ICCProfile is the subset of an embedded ICC profile needed to convert a matrix/TRC
+// based RGB profile (e.g. Adobe RGB, Display P3 or ProPhoto) to sRGB.
+type ICCProfile struct {
+	Raw        []byte
+	ColorSpace string
+	colorants  [3][3]float64
+	curves     [3]toneCurve
+	matrix     bool
+}
+
+// toneCurve linearizes a single encoded channel value in the range 0..1.
+type toneCurve func(float64) float64
+
+// ReadICCProfile returns the raw ICC profile embedded in a jpeg or png, or nil.
+func ReadICCProfile(b []byte) []byte {
+	switch {
+	case isJPEG(b):
+		return readJPEGProfile(b)
+	case bytes.HasPrefix(b, pngHeader):
+		return readPNGProfile(b)
+	}
+	return nil
+}
+
+func readJPEGProfile(b []byte) []byte {
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	chunks := make([]chunk, 0)
+	_, _ = jpegSegments(b, func(marker byte, payload []byte) ([]byte, error) {
+		// Profiles larger than a segment are split into numbered chunks.
+		if marker == 0xE2 && bytes.HasPrefix(payload, iccHeader) && len(payload) > len(iccHeader)+2 {
+			chunks = append(chunks, chunk{seq: payload[len(iccHeader)], data: payload[len(iccHeader)+2:]})
+		}
+		return nil, nil
+	})
+	if len(chunks) == 0 {
+		return nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	profile := make([]byte, 0)
+	for _, c := range chunks {
+		profile = append(profile, c.data...)
+	}
+	return profile
+}
+
+func readPNGProfile(b []byte) []byte {
+	for i := len(pngHeader); i+12 <= len(b); {
+		length := int(binary.BigEndian.Uint32(b[i:]))
+		if i+12+length > len(b) {
+			return nil
+		}
+		typ := string(b[i+4 : i+8])
+		if typ == "IDAT" {
+			return nil
+		}
+		if typ == "iCCP" {
+			data := b[i+8 : i+8+length]
+			// Profile name, null separator and the compression method byte.
+			name := bytes.IndexByte(data, 0)
+			if name == -1 || name+2 > len(data) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(data[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// ParseICCProfile reads the header and the tags needed for a matrix/TRC conversion.
+// Profiles which use lookup tables instead are parsed but can't be converted, and degenerate
+// profiles, which can't produce colors, are rejected.
+func ParseICCProfile(b []byte) (*ICCProfile, error) {
+	if len(b) < 132 || string(b[36:40]) != "acsp" {
+		return nil, errors.New("invalid icc profile")
+	}
+	p := &ICCProfile{Raw: b, ColorSpace: string(bytes.TrimSpace(b[16:20]))}
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(b[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(b); i++ {
+		at := 132 + i*12
+		offset := int(binary.BigEndian.Uint32(b[at+4:]))
+		size := int(binary.BigEndian.Uint32(b[at+8:]))
+		if offset+size <= len(b) {
+			tags[string(b[at:at+4])] = b[offset : offset+size]
+		}
+	}
+	if p.ColorSpace != "RGB" || string(b[20:24]) != "XYZ " {
+		return p, nil
+	}
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, ok := parseXYZ(tags[sig])
+		if !ok {
+			return p, nil
+		}
+		for row := 0; row < 3; row++ {
+			p.colorants[row][i] = xyz[row]
+		}
+	}
+	if _, err := invert3(p.colorants); err != nil {
+		return nil, err
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseCurve(tags[sig])
+		if errors.Is(err, errLookupProfile) {
+			return p, nil
+		} else if err != nil {
+			return nil, err
+		}
+		p.curves[i] = curve
+	}
+	p.matrix = true
+	return p, nil
+}
+
+// Convertible is true when the profile can be converted to sRGB.
+func (p *ICCProfile) Convertible() bool {
+	return p.matrix
+}
+
+// IsSRGB is true when the profile is (close enough to) sRGB that no conversion is needed.
+func (p *ICCProfile) IsSRGB() bool {
+	if !p.matrix {
+		return false
+	}
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			if math.Abs(p.colorants[row][col]-srgbColorants[row][col]) > 0.003 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.curves {
+		for _, v := range []float64{0.1, 0.5, 0.9} {
+			if math.Abs(c(v)-srgbDecode(v)) > 0.005 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ColorManage converts an image to sRGB according to the profile embedded in the original
+// bytes it was decoded from. Profiles that can't be converted are returned so they can be
+// embedded into the derivative instead. A nil profile means the image is ready for the web.
+func ColorManage(img *image.NRGBA, original []byte) (*image.NRGBA, []byte) {
+	raw := ReadICCProfile(original)
+	if raw == nil {
+		return img, nil
+	}
+	p, err := ParseICCProfile(raw)
+	if err != nil || p.ColorSpace != "RGB" {
+		// The decoder already produced RGB pixels so a CMYK or gray profile no longer applies.
+		return img, nil
+	}
+	if !p.Convertible() {
+		return img, raw
+	}
+	if p.IsSRGB() {
+		return img, nil
+	}
+	return p.ToSRGB(img), nil
+}
+
+// ToSRGB converts every pixel from the profile's color space to sRGB.
+func (p *ICCProfile) ToSRGB(img *image.NRGBA) *image.NRGBA {
+	inv, err := invert3(srgbColorants)
+	if err != nil {
+		return img
+	}
+	m := mul3(inv, p.colorants)
+	var lin [3][256]float64
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			lin[c][v] = p.curves[c](float64(v) / 255)
+		}
+	}
+	var enc [4096]uint8
+	for i := range enc {
+		enc[i] = uint8(math.Round(srgbEncode(float64(i)/4095) * 255))
+	}
+	encode := func(v float64) uint8 {
+		if math.IsNaN(v) || v <= 0 {
+			return 0
+		}
+		if v >= 1 {
+			return 255
+		}
+		return enc[int(v*4095+0.5)]
+	}
+	dst := image.NewNRGBA(img.Rect)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		i := img.PixOffset(img.Rect.Min.X, y)
+		end := i + img.Rect.Dx()*4
+		for ; i < end; i += 4 {
+			r := lin[0][img.Pix[i]]
+			g := lin[1][img.Pix[i+1]]
+			b := lin[2][img.Pix[i+2]]
+			dst.Pix[i] = encode(m[0][0]*r + m[0][1]*g + m[0][2]*b)
+			dst.Pix[i+1] = encode(m[1][0]*r + m[1][1]*g + m[1][2]*b)
+			dst.Pix[i+2] = encode(m[2][0]*r + m[2][1]*g + m[2][2]*b)
+			dst.Pix[i+3] = img.Pix[i+3]
+		}
+	}
+	return dst
+}
+
+// EmbedICCProfile inserts a profile into a jpeg, split across as many APP2 segments as needed.
+func EmbedICCProfile(b []byte, profile []byte) []byte {
+	if !isJPEG(b) || len(profile) == 0 {
+		return b
+	}
+	const max = 0xFFFF - 2 - 14
+	total := (len(profile) + max - 1) / max
+	if total > 255 {
+		return b
+	}
+	out := append([]byte{}, b[:2]...)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * max
+		if end > len(profile) {
+			end = len(profile)
+		}
+		payload := append(append([]byte{}, iccHeader...), byte(i+1), byte(total))
+		out = append(out, segment(0xE2, append(payload, profile[i*max:end]...))...)
+	}
+	return append(out, b[2:]...)
+}
+
+func parseXYZ(b []byte) ([3]float64, bool) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15Fixed16(b[8:]), s15Fixed16(b[12:]), s15Fixed16(b[16:])}, true
+}
+
+// parseCurve reads a tone curve. Curves which can't be evaluated return errLookupProfile, and
+// curves which don't produce finite values for every input return errDegenerateProfile.
+func parseCurve(b []byte) (toneCurve, error) {
+	curve, err := readCurve(b)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i <= 255; i++ {
+		if v := curve(float64(i) / 255); math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errDegenerateProfile
+		}
+	}
+	return curve, nil
+}
+
+func readCurve(b []byte) (toneCurve, error) {
+	if len(b) < 12 {
+		return nil, errLookupProfile
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+n*2 {
+			return nil, errLookupProfile
+		}
+		switch n {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(b[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(b[12+i*2:])) / 65535
+		}
+		return func(v float64) float64 {
+			pos := v * float64(n-1)
+			i := int(pos)
+			if i >= n-1 {
+				return table[n-1]
+			}
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+	case "para":
+		fn := binary.BigEndian.Uint16(b[8:])
+		counts := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		n, ok := counts[fn]
+		if !ok || len(b) < 12+n*4 {
+			return nil, errLookupProfile
+		}
+		var prm [7]float64
+		for i := 0; i < n; i++ {
+			prm[i] = s15Fixed16(b[12+i*4:])
+		}
+		if fn > 0 && prm[1] == 0 {
+			return nil, errDegenerateProfile
+		}
+		g, a, bb, c, d, e, f := prm[0], prm[1], prm[2], prm[3], prm[4], prm[5], prm[6]
+		return func(v float64) float64 {
+			switch fn {
+			case 1:
+				if v >= -bb/a {
+					return math.Pow(a*v+bb, g)
+				}
+				return 0
+			case 2:
+				if v >= -bb/a {
+					return math.Pow(a*v+bb, g) + c
+				}
+				return c
+			case 3:
+				if v >= d {
+					return math.Pow(a*v+bb, g)
+				}
+				return c * v
+			case 4:
+				if v >= d {
+					return math.Pow(a*v+bb, g) + e
+				}
+				return c*v + f
+			}
+			return math.Pow(v, g)
+		}, nil
+	}
+	return nil, errLookupProfile
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func mul3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// invert3 inverts a matrix. It returns errDegenerateProfile when the matrix is singular.
+func invert3(m [3][3]float64) ([3][3]float64, error) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-9 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return [3][3]float64{}, errDegenerateProfile
+	}
+	return [3][3]float64{
+		{(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det, (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det, (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det},
+		{(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det, (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det, (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det},
+	}, nil
+}
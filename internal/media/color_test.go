@@ -0,0 +1,192 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"path"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// Published D65 conversion matrices from linear Display P3 and Adobe RGB to linear sRGB.
+var (
+	p3ToSRGB = [3][3]float64{
+		{1.2249401, -0.2249404, 0},
+		{-0.0420569, 1.0420571, 0},
+		{-0.0196376, -0.0786361, 1.0982735},
+	}
+	adobeToSRGB = [3][3]float64{
+		{1.3982, -0.3982, 0},
+		{0, 1, 0},
+		{0, -0.0429, 1.0429},
+	}
+)
+
+func openFixture(t *testing.T, name string) ([]byte, *image.NRGBA) {
+	b, err := ioutil.ReadFile(path.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := imaging.Open(path.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, imaging.Clone(img)
+}
+
+// expected converts an encoded pixel with a reference matrix and decoding function.
+func expected(m [3][3]float64, decode func(float64) float64, px []uint8) [3]float64 {
+	var out [3]float64
+	lin := [3]float64{decode(float64(px[0]) / 255), decode(float64(px[1]) / 255), decode(float64(px[2]) / 255)}
+	for i := 0; i < 3; i++ {
+		v := m[i][0]*lin[0] + m[i][1]*lin[1] + m[i][2]*lin[2]
+		out[i] = math.Round(srgbEncode(math.Max(0, math.Min(1, v))) * 255)
+	}
+	return out
+}
+
+func assertPixel(t *testing.T, name string, got []uint8, want [3]float64) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		if math.Abs(float64(got[i])-want[i]) > 2 {
+			t.Errorf("%s: expected %v. got %v", name, want, got[:3])
+			return
+		}
+	}
+}
+
+func TestColorManageDisplayP3(t *testing.T) {
+	b, img := openFixture(t, "display-p3.png")
+	p, err := ParseICCProfile(ReadICCProfile(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Convertible() || p.IsSRGB() {
+		t.Fatalf("expected a convertible wide gamut profile")
+	}
+	dst, embed := ColorManage(img, b)
+	if embed != nil {
+		t.Fatal("expected the profile to be converted rather than embedded")
+	}
+	red := img.Pix[img.PixOffset(0, 0):]
+	assertPixel(t, "red", dst.Pix[dst.PixOffset(0, 0):], expected(p3ToSRGB, srgbDecode, red))
+	if dst.Pix[0] <= red[0] || dst.Pix[1] >= red[1] {
+		t.Errorf("expected the red to be more saturated in sRGB. got %v from %v", dst.Pix[:3], red[:3])
+	}
+	// Both color spaces share the D65 white point and tone curve so grays are untouched.
+	assertPixel(t, "gray", dst.Pix[dst.PixOffset(12, 4):], [3]float64{128, 128, 128})
+}
+
+func TestColorManageAdobeRGB(t *testing.T) {
+	b, img := openFixture(t, "adobe-rgb.jpg")
+	dst, embed := ColorManage(img, b)
+	if embed != nil {
+		t.Fatal("expected the profile to be converted rather than embedded")
+	}
+	gamma := func(v float64) float64 { return math.Pow(v, 563.0/256) }
+	assertPixel(t, "green", dst.Pix[dst.PixOffset(8, 8):], expected(adobeToSRGB, gamma, img.Pix[img.PixOffset(8, 8):]))
+}
+
+func TestColorManageWithoutProfile(t *testing.T) {
+	b := jpegWithApp1(t, 4, 4, nil)
+	img := imaging.New(4, 4, image.White.C)
+	if dst, embed := ColorManage(img, b); dst != img || embed != nil {
+		t.Error("expected images without a profile to be left alone")
+	}
+}
+
+func TestEmbedICCProfile(t *testing.T) {
+	b, _ := openFixture(t, "adobe-rgb.jpg")
+	profile := ReadICCProfile(b)
+	large := make([]byte, 150000)
+	copy(large, profile)
+	out := EmbedICCProfile(jpegWithApp1(t, 4, 4, nil), large)
+	if got := ReadICCProfile(out); len(got) != len(large) || string(got[:len(profile)]) != string(profile) {
+		t.Errorf("expected the profile to survive being split across segments. got %d bytes", len(got))
+	}
+}
+
+// buildICCProfile encodes an RGB matrix/TRC profile with the same curve for every channel.
+func buildICCProfile(colorants [3][3]float64, curve []byte) []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	tags := make([]tag, 0, 6)
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for row := 0; row < 3; row++ {
+			v := make([]byte, 4)
+			binary.BigEndian.PutUint32(v, uint32(int32(colorants[row][i]*65536)))
+			xyz = append(xyz, v...)
+		}
+		tags = append(tags, tag{sig, xyz})
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, tag{sig, curve})
+	}
+	b := make([]byte, 132+len(tags)*12)
+	copy(b[16:], "RGB ")
+	copy(b[20:], "XYZ ")
+	copy(b[36:], "acsp")
+	binary.BigEndian.PutUint32(b[128:], uint32(len(tags)))
+	for i, t := range tags {
+		at := 132 + i*12
+		copy(b[at:], t.sig)
+		binary.BigEndian.PutUint32(b[at+4:], uint32(len(b)))
+		binary.BigEndian.PutUint32(b[at+8:], uint32(len(t.data)))
+		b = append(b, t.data...)
+	}
+	return b
+}
+
+// paraCurve encodes a parametric curve.
+func paraCurve(fn uint16, params ...float64) []byte {
+	b := []byte("para\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint16(b[8:], fn)
+	for _, p := range params {
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, uint32(int32(p*65536)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+func TestColorManageDegenerateProfile(t *testing.T) {
+	singular := [3][3]float64{{0.4, 0.4, 0.1}, {0.2, 0.2, 0.06}, {0.01, 0.01, 0.7}}
+	for name, profile := range map[string][]byte{
+		"singular matrix":   buildICCProfile(singular, paraCurve(0, 2.2)),
+		"negative exponent": buildICCProfile(srgbColorants, paraCurve(3, 2.4, -1, 0, 1, 0)),
+		"zero slope":        buildICCProfile(srgbColorants, paraCurve(1, 2.2, 0, 0)),
+	} {
+		if _, err := ParseICCProfile(profile); err == nil {
+			t.Errorf("%s: expected the profile to be rejected", name)
+		}
+		_, img := openFixture(t, "adobe-rgb.jpg")
+		enc := &bytes.Buffer{}
+		if err := jpeg.Encode(enc, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		converted, embed := ColorManage(img, EmbedICCProfile(enc.Bytes(), profile))
+		if converted != img || embed != nil {
+			t.Errorf("%s: expected the image to be left alone", name)
+		}
+	}
+	if _, err := ParseICCProfile(buildICCProfile(srgbColorants, paraCurve(0, 2.2))); err != nil {
+		t.Errorf("expected a valid profile to be parsed. got %v", err)
+	}
+}
+
+func TestToSRGBNaN(t *testing.T) {
+	nan := func(float64) float64 { return math.NaN() }
+	p := &ICCProfile{colorants: srgbColorants, curves: [3]toneCurve{nan, nan, nan}, matrix: true}
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	if out := p.ToSRGB(img); out.Pix[0] != 0 {
+		t.Errorf("expected NaN to be encoded as black. got %v", out.Pix[:4])
+	}
+}
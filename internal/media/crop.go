@@ -0,0 +1,106 @@
+package media
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// energySize is the longest side of the downscaled image used to find the focal point.
+const energySize = 128
+
+// FillFocus scales and crops an image to exactly w x h while keeping the relative focal
+// point (0..1 on both axes) as close to the center of the crop as the bounds allow.
+func FillFocus(img image.Image, w, h int, fx, fy float64, filter imaging.ResampleFilter) *image.NRGBA {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 || srcW == 0 || srcH == 0 {
+		return &image.NRGBA{}
+	}
+	cropW, cropH := srcW, srcH
+	if float64(srcW)/float64(srcH) > float64(w)/float64(h) {
+		cropW = int(math.Round(float64(srcH) * float64(w) / float64(h)))
+	} else {
+		cropH = int(math.Round(float64(srcW) * float64(h) / float64(w)))
+	}
+	x := clampInt(int(math.Round(fx*float64(srcW)))-cropW/2, 0, srcW-cropW)
+	y := clampInt(int(math.Round(fy*float64(srcH)))-cropH/2, 0, srcH-cropH)
+	cropped := imaging.Crop(img, image.Rect(b.Min.X+x, b.Min.Y+y, b.Min.X+x+cropW, b.Min.Y+y+cropH))
+	return imaging.Resize(cropped, w, h, filter)
+}
+
+// SmartFocalPoint finds the most interesting region for a crop with the given aspect ratio
+// (width / height). Interest is the edge energy of the image: flat sky, walls and out of
+// focus backgrounds score low while faces, text and in focus subjects score high.
+func SmartFocalPoint(img image.Image, aspect float64) (float64, float64) {
+	small := imaging.Grayscale(imaging.Fit(img, energySize, energySize, imaging.Box))
+	w, h := small.Rect.Dx(), small.Rect.Dy()
+	if w < 3 || h < 3 || aspect <= 0 {
+		return 0.5, 0.5
+	}
+	cols := make([]float64, w)
+	rows := make([]float64, h)
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := lum(small, x+1, y) - lum(small, x-1, y)
+			gy := lum(small, x, y+1) - lum(small, x, y-1)
+			e := math.Sqrt(gx*gx + gy*gy)
+			cols[x] += e
+			rows[y] += e
+		}
+	}
+	if float64(w)/float64(h) > aspect {
+		window := int(math.Round(float64(h) * aspect))
+		return bestWindow(cols, window), 0.5
+	}
+	window := int(math.Round(float64(w) / aspect))
+	return 0.5, bestWindow(rows, window)
+}
+
+// bestWindow slides a window over the energy sums and returns the relative center of the
+// window with the most energy. A slight bias towards the center breaks ties the same way
+// a centered crop would have.
+func bestWindow(sums []float64, window int) float64 {
+	n := len(sums)
+	if window <= 0 || window >= n {
+		return 0.5
+	}
+	total := 0.0
+	for _, v := range sums {
+		total += v
+	}
+	if total == 0 {
+		return 0.5
+	}
+	cur := 0.0
+	for i := 0; i < window; i++ {
+		cur += sums[i]
+	}
+	best, bestScore := 0, -1.0
+	maxOffset := float64(n - window)
+	for i := 0; i+window <= n; i++ {
+		if i > 0 {
+			cur += sums[i+window-1] - sums[i-1]
+		}
+		bias := 1 - 0.1*math.Abs(float64(i)-maxOffset/2)/(maxOffset/2)
+		if score := cur * bias; score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return (float64(best) + float64(window)/2) / float64(n)
+}
+
+func lum(img *image.NRGBA, x, y int) float64 {
+	return float64(img.Pix[img.PixOffset(x, y)])
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
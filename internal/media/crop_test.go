@@ -0,0 +1,52 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// portrait is a tall flat image with a detailed subject near the top, like a head.
+func portrait() *image.NRGBA {
+	img := imaging.New(200, 400, color.NRGBA{200, 200, 200, 255})
+	for x := 70; x < 130; x++ {
+		for y := 30; y < 110; y++ {
+			if (x+y)%4 < 2 {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestSmartFocalPoint(t *testing.T) {
+	fx, fy := SmartFocalPoint(portrait(), 1)
+	if fx != 0.5 {
+		t.Errorf("expected no horizontal movement for a square crop of a portrait. got %f", fx)
+	}
+	if fy > 0.35 {
+		t.Errorf("expected the focal point to move up towards the subject. got %f", fy)
+	}
+	if _, fy := SmartFocalPoint(imaging.New(200, 400, color.White), 1); fy != 0.5 {
+		t.Errorf("expected a flat image to be cropped in the center. got %f", fy)
+	}
+}
+
+func TestFillFocus(t *testing.T) {
+	img := portrait()
+	fx, fy := SmartFocalPoint(img, 1)
+	dst := FillFocus(img, 50, 50, fx, fy, imaging.Lanczos)
+	if dst.Rect.Dx() != 50 || dst.Rect.Dy() != 50 {
+		t.Fatalf("expected a 50x50 crop. got %v", dst.Rect)
+	}
+	// The subject is at the top so the top-middle of the crop should be detailed (dark-ish).
+	if c := dst.NRGBAAt(25, 10); c.R > 180 {
+		t.Errorf("expected the subject to be within the crop. got %v", c)
+	}
+	// A focal point outside of the image is clamped to the edge.
+	if dst := FillFocus(img, 50, 50, 0.5, 2, imaging.Box); dst.NRGBAAt(25, 10).R < 190 {
+		t.Errorf("expected the bottom of the image which is flat. got %v", dst.NRGBAAt(25, 10))
+	}
+}
@@ -0,0 +1,288 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	// Register the decoders needed by image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Metadata is the technical information extracted from a photo's EXIF and XMP blocks.
+type Metadata struct {
+	CaptureTime  string  `json:"captureTime,omitempty"`
+	Make         string  `json:"make,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Lens         string  `json:"lens,omitempty"`
+	FocalLength  float64 `json:"focalLength,omitempty"`
+	Aperture     float64 `json:"aperture,omitempty"`
+	ExposureTime string  `json:"exposureTime,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	Latitude     float64 `json:"lat,omitempty"`
+	Longitude    float64 `json:"lng,omitempty"`
+	HasGPS       bool    `json:"hasGps,omitempty"`
+	Width        int     `json:"width,omitempty"`
+	Height       int     `json:"height,omitempty"`
+	Orientation  int     `json:"orientation,omitempty"`
+	Extracted    bool    `json:"extracted,omitempty"`
+}
+
+// Camera is the make and model in a single human friendly string.
+func (m Metadata) Camera() string {
+	if m.Model == "" {
+		return m.Make
+	}
+	// Most manufacturers already prefix the model with the make.
+	if m.Make == "" || strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		return m.Model
+	}
+	return fmt.Sprintf("%s %s", m.Make, m.Model)
+}
+
+// Captured parses the capture time. The zero time is returned if it is unknown.
+func (m Metadata) Captured() time.Time {
+	t, err := time.Parse(time.RFC3339, m.CaptureTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Rotated is true when the orientation swaps the width and height of the photo.
+func (m Metadata) Rotated() bool {
+	return m.Orientation >= 5 && m.Orientation <= 8
+}
+
+// DisplayWidth is the width of the photo once the orientation has been applied.
+func (m Metadata) DisplayWidth() int {
+	if m.Rotated() {
+		return m.Height
+	}
+	return m.Width
+}
+
+// DisplayHeight is the height of the photo once the orientation has been applied.
+func (m Metadata) DisplayHeight() int {
+	if m.Rotated() {
+		return m.Width
+	}
+	return m.Height
+}
+
+// FocalLengthString formats the focal length, e.g. "35mm".
+func (m Metadata) FocalLengthString() string {
+	if m.FocalLength == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%smm", trimFloat(m.FocalLength))
+}
+
+// ApertureString formats the aperture, e.g. "f/2.8".
+func (m Metadata) ApertureString() string {
+	if m.Aperture == 0 {
+		return ""
+	}
+	return fmt.Sprintf("f/%s", trimFloat(m.Aperture))
+}
+
+// ReadMetadataFile extracts the metadata of a photo on disk.
+func ReadMetadataFile(file string) (Metadata, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return ReadMetadata(b), nil
+}
+
+// ReadMetadata extracts the metadata from the raw bytes of a photo. A missing or
+// corrupt EXIF block is not treated as an error since the photo itself may be perfectly
+// fine. In that case only the dimensions (and whatever XMP provides) will be populated.
+func ReadMetadata(b []byte) Metadata {
+	m := Metadata{Extracted: true}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(b)); err == nil {
+		m.Width = cfg.Width
+		m.Height = cfg.Height
+	}
+	// A partially decoded block is still returned alongside non-critical errors.
+	if x, _ := exif.Decode(bytes.NewReader(b)); x != nil {
+		readExif(x, &m)
+	}
+	readXMP(b, &m)
+	return m
+}
+
+func readExif(x *exif.Exif, m *Metadata) {
+	if t, err := x.DateTime(); err == nil {
+		m.CaptureTime = t.Format(time.RFC3339)
+	}
+	m.Make = exifString(x, exif.Make)
+	m.Model = exifString(x, exif.Model)
+	m.Lens = exifString(x, exif.LensModel)
+	m.FocalLength = exifFloat(x, exif.FocalLength)
+	m.Aperture = exifFloat(x, exif.FNumber)
+	if num, den, ok := exifRat(x, exif.ExposureTime); ok {
+		m.ExposureTime = formatExposure(num, den)
+	}
+	m.ISO = exifInt(x, exif.ISOSpeedRatings)
+	if lat, lng, ok := exifLatLong(x); ok {
+		m.Latitude = lat
+		m.Longitude = lng
+		m.HasGPS = true
+	}
+	m.Orientation = exifInt(x, exif.Orientation)
+	// Some formats (e.g. TIFF based RAW) can't be decoded by image.DecodeConfig.
+	if m.Width == 0 {
+		m.Width = exifInt(x, exif.PixelXDimension)
+		m.Height = exifInt(x, exif.PixelYDimension)
+	}
+}
+
+var xmpAttr = regexp.MustCompile(`(?s)(aux:Lens|exifEX:LensModel|exif:DateTimeOriginal|xmp:CreateDate|tiff:Make|tiff:Model)\s*=\s*"([^"]*)"`)
+
+// readXMP fills in gaps from the XMP packet. Editors like Lightroom frequently keep
+// the lens and capture time only in XMP.
+func readXMP(b []byte, m *Metadata) {
+	start := bytes.Index(b, []byte("<x:xmpmeta"))
+	if start == -1 {
+		return
+	}
+	end := bytes.Index(b[start:], []byte("</x:xmpmeta>"))
+	if end == -1 {
+		return
+	}
+	for _, match := range xmpAttr.FindAllSubmatch(b[start:start+end], -1) {
+		val := strings.TrimSpace(string(match[2]))
+		switch string(match[1]) {
+		case "aux:Lens", "exifEX:LensModel":
+			if m.Lens == "" {
+				m.Lens = val
+			}
+		case "exif:DateTimeOriginal", "xmp:CreateDate":
+			if m.CaptureTime == "" {
+				if t, err := parseXMPTime(val); err == nil {
+					m.CaptureTime = t.Format(time.RFC3339)
+				}
+			}
+		case "tiff:Make":
+			if m.Make == "" {
+				m.Make = val
+			}
+		case "tiff:Model":
+			if m.Model == "" {
+				m.Model = val
+			}
+		}
+	}
+}
+
+func parseXMPTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown xmp time format: %s", s)
+}
+
+// exifTag returns a tag which holds at least one value.
+func exifTag(x *exif.Exif, name exif.FieldName) *tiff.Tag {
+	tag, err := x.Get(name)
+	if err != nil || tag.Count == 0 {
+		return nil
+	}
+	return tag
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag := exifTag(x, name)
+	if tag == nil {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Trim(s, "\x00"))
+}
+
+// exifRat returns the first rational of a tag. Manual lenses often store 0/0, which is
+// treated as missing.
+func exifRat(x *exif.Exif, name exif.FieldName) (int64, int64, bool) {
+	tag := exifTag(x, name)
+	if tag == nil {
+		return 0, 0, false
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0, 0, false
+	}
+	return num, den, true
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	num, den, ok := exifRat(x, name)
+	if !ok {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// exifLatLong reads the location, skipping empty coordinates and zero denominators which
+// would otherwise panic or produce NaN.
+func exifLatLong(x *exif.Exif) (float64, float64, bool) {
+	for _, name := range []exif.FieldName{exif.GPSLatitude, exif.GPSLongitude} {
+		tag := exifTag(x, name)
+		if tag == nil {
+			return 0, 0, false
+		}
+		if tag.Format() == tiff.RatVal {
+			for i := 0; i < int(tag.Count) && i < 3; i++ {
+				if _, den, err := tag.Rat2(i); err != nil || den == 0 {
+					return 0, 0, false
+				}
+			}
+		}
+	}
+	lat, lng, err := x.LatLong()
+	if err != nil || math.IsNaN(lat) || math.IsNaN(lng) || math.IsInf(lat, 0) || math.IsInf(lng, 0) {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag := exifTag(x, name)
+	if tag == nil {
+		return 0
+	}
+	v, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func formatExposure(num, den int64) string {
+	if num == 0 {
+		return ""
+	}
+	if num >= den {
+		return fmt.Sprintf("%ss", trimFloat(float64(num)/float64(den)))
+	}
+	return fmt.Sprintf("1/%d", (den+num/2)/num)
+}
+
+func trimFloat(f float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", f), "0"), ".")
+}
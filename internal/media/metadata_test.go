@@ -0,0 +1,207 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sort"
+	"testing"
+)
+
+// tiffEntry is a single IFD entry used to build EXIF fixtures.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+	sub   []tiffEntry // When set, data is replaced by an offset to this sub IFD.
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	b := append([]byte(s), 0)
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(b)), data: b}
+}
+
+func shortEntry(tag uint16, v uint16) tiffEntry {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return tiffEntry{tag: tag, typ: 3, count: 1, data: b}
+}
+
+func ratEntry(tag uint16, vals ...uint32) tiffEntry {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+	return tiffEntry{tag: tag, typ: 5, count: uint32(len(vals) / 2), data: b}
+}
+
+func subEntry(tag uint16, entries ...tiffEntry) tiffEntry {
+	return tiffEntry{tag: tag, typ: 4, count: 1, sub: entries}
+}
+
+// buildExif encodes a little endian TIFF structure prefixed by the EXIF header.
+func buildExif(entries ...tiffEntry) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("II*\x00")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(8))
+	writeIFD(buf, entries)
+	return append([]byte("Exif\x00\x00"), buf.Bytes()...)
+}
+
+func writeIFD(buf *bytes.Buffer, entries []tiffEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	start := buf.Len()
+	size := 2 + len(entries)*12 + 4
+	ifd := make([]byte, size)
+	extra := &bytes.Buffer{}
+	binary.LittleEndian.PutUint16(ifd, uint16(len(entries)))
+	type pending struct {
+		at      int
+		entries []tiffEntry
+	}
+	subs := make([]pending, 0)
+	for i, e := range entries {
+		at := 2 + i*12
+		binary.LittleEndian.PutUint16(ifd[at:], e.tag)
+		binary.LittleEndian.PutUint16(ifd[at+2:], e.typ)
+		binary.LittleEndian.PutUint32(ifd[at+4:], e.count)
+		switch {
+		case e.sub != nil:
+			subs = append(subs, pending{at: at + 8, entries: e.sub})
+		case len(e.data) <= 4:
+			copy(ifd[at+8:], e.data)
+		default:
+			binary.LittleEndian.PutUint32(ifd[at+8:], uint32(start+size+extra.Len()))
+			extra.Write(e.data)
+		}
+	}
+	buf.Write(ifd)
+	buf.Write(extra.Bytes())
+	for _, sub := range subs {
+		binary.LittleEndian.PutUint32(buf.Bytes()[start+sub.at:], uint32(buf.Len()))
+		writeIFD(buf, sub.entries)
+	}
+}
+
+// jpegWithApp1 encodes a small JPEG and inserts the given APP1 payload after SOI.
+func jpegWithApp1(t *testing.T, w, h int, payload []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	enc := &bytes.Buffer{}
+	if err := jpeg.Encode(enc, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	b := enc.Bytes()
+	if payload == nil {
+		return b
+	}
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	out := append([]byte{}, b[:2]...)
+	out = append(out, seg...)
+	out = append(out, payload...)
+	return append(out, b[2:]...)
+}
+
+func sampleExif() []byte {
+	return buildExif(
+		asciiEntry(0x010F, "Canon"),
+		asciiEntry(0x0110, "Canon EOS R5"),
+		shortEntry(0x0112, 6),
+		subEntry(0x8769,
+			ratEntry(0x829A, 1, 250),
+			ratEntry(0x829D, 28, 10),
+			shortEntry(0x8827, 400),
+			asciiEntry(0x9003, "2020:11:15 10:30:00"),
+			ratEntry(0x920A, 35, 1),
+			asciiEntry(0xA434, "RF35mm F1.8 MACRO IS STM"),
+		),
+		subEntry(0x8825,
+			asciiEntry(0x0001, "N"),
+			ratEntry(0x0002, 37, 1, 46, 1, 30, 1),
+			asciiEntry(0x0003, "W"),
+			ratEntry(0x0004, 122, 1, 25, 1, 10, 1),
+		),
+	)
+}
+
+func TestReadMetadata(t *testing.T) {
+	m := ReadMetadata(jpegWithApp1(t, 40, 20, sampleExif()))
+	if !m.Extracted {
+		t.Fatal("expected metadata to be marked as extracted")
+	}
+	if m.Camera() != "Canon EOS R5" {
+		t.Errorf("expected camera to be Canon EOS R5. got %q", m.Camera())
+	}
+	if m.Lens != "RF35mm F1.8 MACRO IS STM" {
+		t.Errorf("unexpected lens: %q", m.Lens)
+	}
+	if m.FocalLengthString() != "35mm" || m.ApertureString() != "f/2.8" || m.ExposureTime != "1/250" || m.ISO != 400 {
+		t.Errorf("unexpected exposure details: %s %s %s %d", m.FocalLengthString(), m.ApertureString(), m.ExposureTime, m.ISO)
+	}
+	if m.Captured().Year() != 2020 {
+		t.Errorf("unexpected capture time: %q", m.CaptureTime)
+	}
+	if !m.HasGPS || m.Latitude < 37.77 || m.Latitude > 37.78 || m.Longitude > -122.41 || m.Longitude < -122.42 {
+		t.Errorf("unexpected location: %v %f %f", m.HasGPS, m.Latitude, m.Longitude)
+	}
+	if m.Width != 40 || m.Height != 20 || m.DisplayWidth() != 20 || m.DisplayHeight() != 40 {
+		t.Errorf("unexpected dimensions: %dx%d (displayed %dx%d)", m.Width, m.Height, m.DisplayWidth(), m.DisplayHeight())
+	}
+}
+
+func TestReadMetadataWithoutExif(t *testing.T) {
+	m := ReadMetadata(jpegWithApp1(t, 12, 8, nil))
+	if m.Width != 12 || m.Height != 8 {
+		t.Errorf("expected dimensions to be read without exif. got %dx%d", m.Width, m.Height)
+	}
+	if m.Camera() != "" || m.HasGPS {
+		t.Errorf("expected no exif details. got %+v", m)
+	}
+}
+
+func TestReadMetadataXMP(t *testing.T) {
+	xmp := []byte(`http://ns.adobe.com/xap/1.0/` + "\x00" + `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:Description aux:Lens="XF23mmF1.4 R" exif:DateTimeOriginal="2019-06-01T08:00:00"/></x:xmpmeta>`)
+	m := ReadMetadata(jpegWithApp1(t, 4, 4, xmp))
+	if m.Lens != "XF23mmF1.4 R" {
+		t.Errorf("expected lens from xmp. got %q", m.Lens)
+	}
+	if m.Captured().Year() != 2019 {
+		t.Errorf("expected capture time from xmp. got %q", m.CaptureTime)
+	}
+}
+
+func TestReadMetadataZeroDenominators(t *testing.T) {
+	// Manual lenses frequently leave the aperture and focal length as 0/0.
+	b := buildExif(
+		asciiEntry(0x0110, "Leica M6"),
+		subEntry(0x8769,
+			ratEntry(0x829A, 0, 0),
+			ratEntry(0x829D, 0, 0),
+			ratEntry(0x920A, 0, 0),
+		),
+		subEntry(0x8825,
+			asciiEntry(0x0001, "N"),
+			ratEntry(0x0002, 37, 0, 46, 1, 30, 1),
+			asciiEntry(0x0003, "W"),
+			ratEntry(0x0004, 122, 1, 25, 0, 10, 1),
+		),
+	)
+	m := ReadMetadata(jpegWithApp1(t, 8, 8, b))
+	if m.Camera() != "Leica M6" {
+		t.Errorf("expected the rest of the exif to be read. got %q", m.Camera())
+	}
+	if m.Aperture != 0 || m.FocalLength != 0 || m.ExposureTime != "" || m.ISO != 0 {
+		t.Errorf("expected 0/0 values to be skipped. got %+v", m)
+	}
+	if m.HasGPS {
+		t.Errorf("expected an unreadable location to be skipped. got %f %f", m.Latitude, m.Longitude)
+	}
+}
@@ -0,0 +1,49 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// PerceptualHash is a difference hash (dHash) of an image. Unlike a hash of the file it
+// barely changes when a photo is resized, recompressed or lightly edited.
+type PerceptualHash uint64
+
+// NewPerceptualHash hashes an image by comparing the brightness of neighbouring pixels
+// of a 9x8 grayscale copy.
+func NewPerceptualHash(img image.Image) PerceptualHash {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var h PerceptualHash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if small.NRGBAAt(x, y).R < small.NRGBAAt(x+1, y).R {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// ParsePerceptualHash parses the string form of a hash.
+func ParsePerceptualHash(s string) (PerceptualHash, error) {
+	h, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %v", s, err)
+	}
+	return PerceptualHash(h), nil
+}
+
+// Distance is the number of bits which differ between two hashes. 0 is identical and
+// anything up to ~10 is very likely the same photo.
+func (h PerceptualHash) Distance(o PerceptualHash) int {
+	return bits.OnesCount64(uint64(h ^ o))
+}
+
+func (h PerceptualHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
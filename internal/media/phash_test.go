@@ -0,0 +1,45 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// gradient is a photo-like image with detail on both axes.
+func gradient(w, h int) *image.NRGBA {
+	img := imaging.New(w, h, color.White)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			v := uint8((x*255/w + (y*y*255)/(h*h)) / 2)
+			if (x*9/w+y*8/h)%3 == 0 {
+				v = 255 - v
+			}
+			img.Set(x, y, color.NRGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash(t *testing.T) {
+	img := gradient(400, 300)
+	h := NewPerceptualHash(img)
+	if d := h.Distance(NewPerceptualHash(imaging.Resize(img, 120, 90, imaging.Lanczos))); d > 4 {
+		t.Errorf("expected a resized copy to be a near duplicate. got a distance of %d", d)
+	}
+	if d := h.Distance(NewPerceptualHash(imaging.AdjustBrightness(img, 10))); d > 4 {
+		t.Errorf("expected an edited copy to be a near duplicate. got a distance of %d", d)
+	}
+	if d := h.Distance(NewPerceptualHash(imaging.FlipH(img))); d < 20 {
+		t.Errorf("expected a different image to be far away. got a distance of %d", d)
+	}
+	parsed, err := ParsePerceptualHash(h.String())
+	if err != nil || parsed != h {
+		t.Errorf("expected %s to round trip. got %s (%v)", h, parsed, err)
+	}
+	if _, err := ParsePerceptualHash("nope"); err == nil {
+		t.Error("expected an invalid hash to be rejected")
+	}
+}
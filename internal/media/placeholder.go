@@ -0,0 +1,106 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// lqipSize is the longest edge of the inlined preview.
+	lqipSize = 16
+
+	// blurHashComponents is the amount of detail kept along the longest edge of a BlurHash.
+	blurHashComponents = 4
+)
+
+// Placeholder is what a theme can show while a photo is still loading.
+type Placeholder struct {
+	BlurHash string `json:"blurhash,omitempty"`
+	// LQIP is a tiny blurred jpeg as a data URI.
+	LQIP string `json:"lqip,omitempty"`
+	// Color is the dominant color as a hex string, e.g. #aabbcc.
+	Color string `json:"color,omitempty"`
+}
+
+// Empty is true for photos which were synced before placeholders existed.
+func (p Placeholder) Empty() bool {
+	return p.BlurHash == "" && p.LQIP == "" && p.Color == ""
+}
+
+// NewPlaceholder computes the placeholders for an (oriented, sRGB) image.
+func NewPlaceholder(img image.Image) (Placeholder, error) {
+	if img.Bounds().Empty() {
+		return Placeholder{}, fmt.Errorf("can not create a placeholder for an empty image")
+	}
+	// Everything is computed from a small copy since none of it needs detail.
+	small := imaging.Fit(img, 64, 64, imaging.Box)
+	var p Placeholder
+	var err error
+	x, y := blurHashComponents, blurHashComponents
+	if w, h := small.Rect.Dx(), small.Rect.Dy(); w > h {
+		y = clampComponents(blurHashComponents * h / w)
+	} else if h > w {
+		x = clampComponents(blurHashComponents * w / h)
+	}
+	if p.BlurHash, err = blurhash.Encode(x, y, small); err != nil {
+		return Placeholder{}, err
+	}
+	lqip := imaging.Blur(imaging.Fit(small, lqipSize, lqipSize, imaging.Lanczos), 0.5)
+	buf := &bytes.Buffer{}
+	if err = imaging.Encode(buf, lqip, imaging.JPEG, imaging.JPEGQuality(50)); err != nil {
+		return Placeholder{}, err
+	}
+	p.LQIP = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	c := DominantColor(small)
+	p.Color = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	return p, nil
+}
+
+// DominantColor is the average color of the most common group of similar colors.
+// Transparent pixels are ignored.
+func DominantColor(img *image.NRGBA) color.NRGBA {
+	type bucket struct {
+		n, r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < 128 {
+				continue
+			}
+			// 4 bits per channel is coarse enough to group shades of the same color.
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{}
+				buckets[key] = b
+			}
+			b.n++
+			b.r += int(c.R)
+			b.g += int(c.G)
+			b.b += int(c.B)
+			if best == nil || b.n > best.n {
+				best = b
+			}
+		}
+	}
+	if best == nil {
+		return color.NRGBA{A: 255}
+	}
+	return color.NRGBA{uint8(best.r / best.n), uint8(best.g / best.n), uint8(best.b / best.n), 255}
+}
+
+func clampComponents(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
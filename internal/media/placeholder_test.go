@@ -0,0 +1,38 @@
+package media
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+func TestNewPlaceholder(t *testing.T) {
+	img := imaging.New(300, 100, color.NRGBA{200, 30, 40, 255})
+	for x := 0; x < 60; x++ {
+		for y := 0; y < 100; y++ {
+			img.Set(x, y, color.NRGBA{10, 10, 200, 255})
+		}
+	}
+	p, err := NewPlaceholder(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Empty() {
+		t.Fatal("expected a placeholder")
+	}
+	if x, y, err := blurhash.Components(p.BlurHash); err != nil || x != 4 || y != 1 {
+		t.Errorf("expected a 4x1 blurhash for a wide photo. got %dx%d (%v)", x, y, err)
+	}
+	if !strings.HasPrefix(p.LQIP, "data:image/jpeg;base64,") {
+		t.Errorf("expected a jpeg data uri. got %s", p.LQIP)
+	}
+	if p.Color != "#c81e28" {
+		t.Errorf("expected the red to dominate. got %s", p.Color)
+	}
+	if _, err := NewPlaceholder(imaging.New(0, 0, color.White)); err == nil {
+		t.Error("expected an empty image to be rejected")
+	}
+}
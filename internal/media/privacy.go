@@ -0,0 +1,387 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"regexp"
+)
+
+// StripMode describes which metadata should be removed before a photo is published.
+type StripMode int
+
+const (
+	// StripNone keeps every metadata block intact.
+	StripNone StripMode = iota
+	// StripLocation removes GPS coordinates but keeps the remaining metadata.
+	StripLocation
+	// StripAll removes every metadata block except the color profile.
+	StripAll
+)
+
+// ErrUnsupportedFormat is returned when metadata can't be rewritten for a file format.
+var ErrUnsupportedFormat = errors.New("metadata can only be rewritten for jpeg and png files")
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	// xmpExtHeader starts the blocks XMP which doesn't fit a single segment continues in.
+	xmpExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngHeader    = []byte("\x89PNG\r\n\x1a\n")
+	xmpGPSAttr   = regexp.MustCompile(`\s+exif:GPS\w+\s*=\s*"[^"]*"`)
+	xmpGPSElem   = regexp.MustCompile(`(?s)<exif:(GPS\w+)[^>]*>.*?</exif:(GPS\w+)>`)
+)
+
+// Sanitize rewrites the metadata of a jpeg or png file without touching the encoded
+// image data, so the result is still a byte-for-byte copy of the pixels.
+func Sanitize(b []byte, mode StripMode) ([]byte, error) {
+	if mode == StripNone {
+		return b, nil
+	}
+	switch {
+	case isJPEG(b):
+		return sanitizeJPEG(b, mode)
+	case bytes.HasPrefix(b, pngHeader):
+		return sanitizePNG(b, mode)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// CopyExif carries the EXIF block of the original src over to a freshly encoded jpeg.
+// The orientation is reset since derivatives are already rotated, and the embedded
+// thumbnail is dropped since it would show the untouched original.
+func CopyExif(src, dst []byte, mode StripMode) ([]byte, error) {
+	if mode == StripAll || !isJPEG(dst) {
+		return dst, nil
+	}
+	tif := findExif(src)
+	if tif == nil {
+		return dst, nil
+	}
+	tif = append([]byte{}, tif...)
+	if err := rewriteTIFF(tif, mode, true); err != nil {
+		return nil, err
+	}
+	payload := append(append([]byte{}, exifHeader...), tif...)
+	if len(payload)+2 > 0xFFFF {
+		return dst, nil
+	}
+	out := make([]byte, 0, len(dst)+len(payload)+4)
+	out = append(out, dst[:2]...)
+	out = append(out, segment(0xE1, payload)...)
+	return append(out, dst[2:]...), nil
+}
+
+func isJPEG(b []byte) bool {
+	return len(b) > 3 && b[0] == 0xFF && b[1] == 0xD8
+}
+
+// jpegSegments walks the markers preceding the image data. The callback receives the
+// marker and payload (without the length bytes) and returns what should be written in
+// its place; nil drops the segment.
+func jpegSegments(b []byte, fn func(marker byte, payload []byte) ([]byte, error)) ([]byte, error) {
+	out := &bytes.Buffer{}
+	out.Write(b[:2])
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			return nil, errors.New("malformed jpeg marker")
+		}
+		marker := b[i+1]
+		// Start of scan (or end of image): everything after is image data.
+		if marker == 0xDA || marker == 0xD9 {
+			out.Write(b[i:])
+			return out.Bytes(), nil
+		}
+		length := int(binary.BigEndian.Uint16(b[i+2:]))
+		if length < 2 || i+2+length > len(b) {
+			return nil, errors.New("malformed jpeg segment length")
+		}
+		payload, err := fn(marker, b[i+4:i+2+length])
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			out.Write(segment(marker, payload))
+		}
+		i += 2 + length
+	}
+	return nil, errors.New("jpeg has no image data")
+}
+
+func segment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func sanitizeJPEG(b []byte, mode StripMode) ([]byte, error) {
+	return jpegSegments(b, func(marker byte, payload []byte) ([]byte, error) {
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			if mode == StripAll {
+				return nil, nil
+			}
+			p := append([]byte{}, payload...)
+			if err := rewriteTIFF(p[len(exifHeader):], mode, false); err != nil {
+				return nil, err
+			}
+			return p, nil
+		case marker == 0xE1 && bytes.HasPrefix(payload, xmpHeader):
+			if mode == StripAll {
+				return nil, nil
+			}
+			return stripXMPLocation(payload), nil
+		case marker == 0xE1 && bytes.HasPrefix(payload, xmpExtHeader):
+			// Extended XMP is split across segments with a running offset, so it can't be
+			// rewritten one segment at a time and is dropped entirely.
+			return nil, nil
+		case mode == StripAll && (marker == 0xED || marker == 0xFE):
+			// Photoshop/IPTC blocks and comments.
+			return nil, nil
+		}
+		return payload, nil
+	})
+}
+
+func sanitizePNG(b []byte, mode StripMode) ([]byte, error) {
+	out := &bytes.Buffer{}
+	out.Write(pngHeader)
+	i := len(pngHeader)
+	for i+12 <= len(b) {
+		length := int(binary.BigEndian.Uint32(b[i:]))
+		if i+12+length > len(b) {
+			return nil, errors.New("malformed png chunk length")
+		}
+		typ := string(b[i+4 : i+8])
+		data := b[i+8 : i+8+length]
+		i += 12 + length
+		switch typ {
+		case "eXIf":
+			if mode == StripAll {
+				continue
+			}
+			data = append([]byte{}, data...)
+			if err := rewriteTIFF(data, mode, false); err != nil {
+				return nil, err
+			}
+		case "iTXt":
+			if mode == StripAll {
+				continue
+			}
+			// Compressed text can't be inspected cheaply so it is dropped entirely.
+			if kw := bytes.IndexByte(data, 0); kw != -1 && kw+1 < len(data) && data[kw+1] != 0 {
+				continue
+			}
+			data = stripXMPLocation(data)
+		case "tEXt":
+			if mode == StripAll {
+				continue
+			}
+			// ImageMagick and exiftool store EXIF and XMP hex encoded in raw profiles.
+			if kw := bytes.IndexByte(data, 0); kw != -1 && rawProfiles[string(data[:kw])] {
+				continue
+			}
+			data = stripXMPLocation(data)
+		case "zTXt":
+			// Compressed text can't be inspected cheaply so it is dropped entirely.
+			continue
+		case "tIME":
+			if mode == StripAll {
+				continue
+			}
+		}
+		out.Write(pngChunk(typ, data))
+	}
+	return out.Bytes(), nil
+}
+
+// rawProfiles are the keywords of png text chunks which hold hex encoded metadata blocks
+// that may include the location.
+var rawProfiles = map[string]bool{
+	"Raw profile type exif": true,
+	"Raw profile type APP1": true,
+	"Raw profile type xmp":  true,
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, len(data)+12)
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+func stripXMPLocation(b []byte) []byte {
+	b = xmpGPSAttr.ReplaceAll(b, nil)
+	return xmpGPSElem.ReplaceAll(b, nil)
+}
+
+// findExif returns the TIFF structure of the EXIF block of a jpeg or png.
+func findExif(b []byte) []byte {
+	var tif []byte
+	switch {
+	case isJPEG(b):
+		_, _ = jpegSegments(b, func(marker byte, payload []byte) ([]byte, error) {
+			if tif == nil && marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+				tif = payload[len(exifHeader):]
+			}
+			return nil, nil
+		})
+	case bytes.HasPrefix(b, pngHeader):
+		for i := len(pngHeader); i+12 <= len(b); {
+			length := int(binary.BigEndian.Uint32(b[i:]))
+			if i+12+length > len(b) {
+				break
+			}
+			if string(b[i+4:i+8]) == "eXIf" {
+				return b[i+8 : i+8+length]
+			}
+			i += 12 + length
+		}
+	}
+	return tif
+}
+
+const (
+	tagOrientation = 0x0112
+	tagGPSPointer  = 0x8825
+	tagThumbOffset = 0x0201
+	tagThumbLength = 0x0202
+)
+
+// tiffTypeSizes maps a TIFF field type to the byte size of a single value.
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// tiffEditor rewrites a TIFF structure in place. Nothing is ever moved, values are
+// only zeroed, so every offset in the file remains valid.
+type tiffEditor struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func rewriteTIFF(b []byte, mode StripMode, derivative bool) error {
+	t, err := newTiffEditor(b)
+	if err != nil {
+		return err
+	}
+	ifd0 := int(t.order.Uint32(b[4:]))
+	if !t.valid(ifd0, 2) {
+		return errors.New("malformed exif ifd0 offset")
+	}
+	if mode == StripLocation {
+		if gps, ok := t.value(ifd0, tagGPSPointer); ok {
+			t.blankIFD(gps)
+		}
+	}
+	if derivative {
+		t.setShort(ifd0, tagOrientation, 1)
+		next := ifd0 + 2 + t.entries(ifd0)*12
+		if t.valid(next, 4) {
+			if ifd1 := int(t.order.Uint32(b[next:])); ifd1 != 0 {
+				t.blankThumbnail(ifd1)
+				t.blankIFD(ifd1)
+			}
+			t.order.PutUint32(b[next:], 0)
+		}
+	}
+	return nil
+}
+
+func newTiffEditor(b []byte) (*tiffEditor, error) {
+	if len(b) < 8 {
+		return nil, errors.New("exif block is too short")
+	}
+	switch string(b[:2]) {
+	case "II":
+		return &tiffEditor{b: b, order: binary.LittleEndian}, nil
+	case "MM":
+		return &tiffEditor{b: b, order: binary.BigEndian}, nil
+	}
+	return nil, errors.New("exif block has an unknown byte order")
+}
+
+func (t *tiffEditor) valid(offset, size int) bool {
+	return offset > 0 && offset+size <= len(t.b)
+}
+
+func (t *tiffEditor) entries(ifd int) int {
+	if !t.valid(ifd, 2) {
+		return 0
+	}
+	n := int(t.order.Uint16(t.b[ifd:]))
+	if !t.valid(ifd, 2+n*12) {
+		return 0
+	}
+	return n
+}
+
+func (t *tiffEditor) find(ifd int, tag uint16) int {
+	if !t.valid(ifd, 2) {
+		return -1
+	}
+	for i := 0; i < t.entries(ifd); i++ {
+		at := ifd + 2 + i*12
+		if t.order.Uint16(t.b[at:]) == tag {
+			return at
+		}
+	}
+	return -1
+}
+
+// value reads a single SHORT or LONG value.
+func (t *tiffEditor) value(ifd int, tag uint16) (int, bool) {
+	at := t.find(ifd, tag)
+	if at == -1 {
+		return 0, false
+	}
+	if t.order.Uint16(t.b[at+2:]) == 3 {
+		return int(t.order.Uint16(t.b[at+8:])), true
+	}
+	return int(t.order.Uint32(t.b[at+8:])), true
+}
+
+func (t *tiffEditor) setShort(ifd int, tag uint16, v uint16) {
+	if at := t.find(ifd, tag); at != -1 && t.order.Uint16(t.b[at+2:]) == 3 {
+		t.order.PutUint16(t.b[at+8:], v)
+	}
+}
+
+// blankIFD zeroes every value of an IFD, including those stored outside of it, and
+// leaves an empty IFD behind so pointers to it remain valid.
+func (t *tiffEditor) blankIFD(ifd int) {
+	n := t.entries(ifd)
+	if n == 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		at := ifd + 2 + i*12
+		size := tiffTypeSizes[t.order.Uint16(t.b[at+2:])] * int(t.order.Uint32(t.b[at+4:]))
+		if size > 4 {
+			if off := int(t.order.Uint32(t.b[at+8:])); t.valid(off, size) {
+				zero(t.b[off : off+size])
+			}
+		}
+	}
+	zero(t.b[ifd : ifd+2+n*12])
+}
+
+func (t *tiffEditor) blankThumbnail(ifd int) {
+	off, ok := t.value(ifd, tagThumbOffset)
+	if !ok {
+		return
+	}
+	length, ok := t.value(ifd, tagThumbLength)
+	if ok && t.valid(off, length) {
+		zero(t.b[off : off+length])
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
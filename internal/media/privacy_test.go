@@ -0,0 +1,125 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"testing"
+)
+
+func TestSanitizeStripLocation(t *testing.T) {
+	src := jpegWithApp1(t, 16, 16, sampleExif())
+	b, err := Sanitize(src, StripLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := ReadMetadata(b)
+	if m.HasGPS {
+		t.Errorf("expected the location to be removed. got %f %f", m.Latitude, m.Longitude)
+	}
+	if m.Camera() != "Canon EOS R5" || m.ISO != 400 {
+		t.Errorf("expected the remaining metadata to be kept. got %+v", m)
+	}
+	if len(b) != len(src) {
+		t.Errorf("expected the file to be rewritten in place. got %d bytes, want %d", len(b), len(src))
+	}
+}
+
+func TestSanitizeStripAll(t *testing.T) {
+	src := jpegWithApp1(t, 16, 16, sampleExif())
+	b, err := Sanitize(src, StripAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := ReadMetadata(b); m.Camera() != "" || m.HasGPS || m.Width != 16 {
+		t.Errorf("expected only the dimensions to remain. got %+v", m)
+	}
+	if bytes.Contains(b, []byte("Canon")) {
+		t.Error("expected no trace of the exif block")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(b)); err != nil {
+		t.Errorf("expected a valid jpeg: %v", err)
+	}
+}
+
+func TestSanitizeUnsupported(t *testing.T) {
+	if _, err := Sanitize([]byte("RIFF....WEBPVP8 "), StripAll); err != ErrUnsupportedFormat {
+		t.Errorf("expected ErrUnsupportedFormat. got %v", err)
+	}
+}
+
+func TestCopyExif(t *testing.T) {
+	src := jpegWithApp1(t, 16, 16, sampleExif())
+	dst := jpegWithApp1(t, 8, 8, nil)
+	b, err := CopyExif(src, dst, StripLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := ReadMetadata(b)
+	if m.Camera() != "Canon EOS R5" || m.HasGPS {
+		t.Errorf("expected camera without location. got %+v", m)
+	}
+	if m.Orientation != 1 || m.Width != 8 {
+		t.Errorf("expected the orientation to be reset on the 8px derivative. got %d (%dpx)", m.Orientation, m.Width)
+	}
+	if b, _ := CopyExif(src, dst, StripAll); !bytes.Equal(b, dst) {
+		t.Error("expected nothing to be copied when stripping all metadata")
+	}
+}
+
+func TestRewriteTIFFTruncated(t *testing.T) {
+	// IFD0 holds a GPS pointer and is followed by an IFD1 pointer, both past the end of a
+	// corrupt or truncated block.
+	for _, pointer := range []uint32{28, 31, 1 << 20} {
+		b := []byte("II*\x00\x08\x00\x00\x00")
+		b = append(b, 1, 0)
+		entry := make([]byte, 12)
+		binary.LittleEndian.PutUint16(entry, tagGPSPointer)
+		binary.LittleEndian.PutUint16(entry[2:], 4)
+		binary.LittleEndian.PutUint32(entry[4:], 1)
+		binary.LittleEndian.PutUint32(entry[8:], pointer)
+		b = append(b, entry...)
+		next := make([]byte, 4)
+		binary.LittleEndian.PutUint32(next, pointer)
+		b = append(b, next...)
+		b = append(b, 0xFF, 0xFF, 0xFF)
+		if err := rewriteTIFF(b, StripLocation, true); err != nil {
+			t.Errorf("expected pointers past the end to be ignored. got %v", err)
+		}
+	}
+}
+
+func TestSanitizeStripLocationPNGText(t *testing.T) {
+	gps := `<rdf:Description exif:GPSLatitude="37,46.5N" exif:Make="Canon"/>`
+	b := append([]byte{}, pngHeader...)
+	b = append(b, pngChunk("IHDR", make([]byte, 13))...)
+	b = append(b, pngChunk("tEXt", []byte("XML:com.adobe.xmp\x00"+gps))...)
+	b = append(b, pngChunk("tEXt", []byte("Raw profile type exif\x00\nexif\n 4\n45786966"))...)
+	b = append(b, pngChunk("zTXt", []byte("Raw profile type xmp\x00\x00compressed"))...)
+	b = append(b, pngChunk("tEXt", []byte("Title\x00Beach"))...)
+	b = append(b, pngChunk("IEND", nil)...)
+	out, err := Sanitize(b, StripLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("GPS")) || bytes.Contains(out, []byte("Raw profile")) {
+		t.Errorf("expected the location to be removed from the text chunks. got %q", out)
+	}
+	if !bytes.Contains(out, []byte(`exif:Make="Canon"`)) || !bytes.Contains(out, []byte("Beach")) {
+		t.Errorf("expected the remaining text to be kept. got %q", out)
+	}
+}
+
+func TestSanitizeStripLocationExtendedXMP(t *testing.T) {
+	ext := append(append([]byte{}, xmpExtHeader...), []byte(`0123456789ABCDEF0123456789ABCDEF....<exif:GPSLatitude>37,46.5N</exif:GPSLatitude>`)...)
+	b, err := Sanitize(jpegWithApp1(t, 8, 8, ext), StripLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("GPS")) {
+		t.Error("expected the extended xmp to be removed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(b)); err != nil {
+		t.Errorf("expected a valid jpeg: %v", err)
+	}
+}
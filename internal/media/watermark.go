@@ -0,0 +1,107 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// WatermarkPositions are the places a watermark can be drawn.
+var WatermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+// textMarkSize is the font size text watermarks are rendered at before being scaled down.
+const textMarkSize = 96
+
+// WatermarkOptions describe how a watermark is drawn onto a derivative.
+type WatermarkOptions struct {
+	Mark     image.Image
+	Position string
+	Opacity  float64
+	// Scale is the width of the watermark relative to the width of the derivative.
+	Scale float64
+}
+
+// ValidWatermarkPosition reports whether a position is supported.
+func ValidWatermarkPosition(position string) bool {
+	for _, p := range WatermarkPositions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
+
+// Watermark draws the mark onto a copy of the image.
+func Watermark(img *image.NRGBA, opts WatermarkOptions) *image.NRGBA {
+	if opts.Mark == nil || opts.Scale <= 0 || opts.Opacity <= 0 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	mb := opts.Mark.Bounds()
+	markW := int(math.Round(float64(w) * math.Min(opts.Scale, 1)))
+	markH := int(math.Round(float64(markW) * float64(mb.Dy()) / float64(mb.Dx())))
+	if markH > h {
+		markW = int(math.Round(float64(markW) * float64(h) / float64(markH)))
+		markH = h
+	}
+	if markW < 1 || markH < 1 {
+		return img
+	}
+	mark := imaging.Resize(opts.Mark, markW, markH, imaging.Lanczos)
+	margin := int(math.Round(math.Min(float64(w), float64(h)) * 0.03))
+	var pt image.Point
+	switch opts.Position {
+	case "top-left":
+		pt = image.Pt(margin, margin)
+	case "top-right":
+		pt = image.Pt(w-markW-margin, margin)
+	case "bottom-left":
+		pt = image.Pt(margin, h-markH-margin)
+	case "center":
+		pt = image.Pt((w-markW)/2, (h-markH)/2)
+	default:
+		pt = image.Pt(w-markW-margin, h-markH-margin)
+	}
+	return imaging.Overlay(img, mark, pt, math.Min(opts.Opacity, 1))
+}
+
+// TextMark renders text as a white watermark with a soft shadow so it remains legible on
+// both light and dark photos.
+func TextMark(text string) (image.Image, error) {
+	f, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: textMarkSize, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	bounds, advance := font.BoundString(face, text)
+	if advance == 0 {
+		return nil, fmt.Errorf("can not render an empty watermark")
+	}
+	pad := textMarkSize / 8
+	width := (bounds.Max.X - bounds.Min.X).Ceil() + pad*2
+	height := (bounds.Max.Y - bounds.Min.Y).Ceil() + pad*2
+	dot := fixed.Point26_6{X: fixed.I(pad) - bounds.Min.X, Y: fixed.I(pad) - bounds.Min.Y}
+
+	shadow := image.NewNRGBA(image.Rect(0, 0, width, height))
+	d := &font.Drawer{Dst: shadow, Src: image.NewUniform(color.NRGBA{0, 0, 0, 160}), Face: face, Dot: dot}
+	d.DrawString(text)
+	mark := imaging.Blur(shadow, float64(pad)/3)
+
+	fg := image.NewNRGBA(image.Rect(0, 0, width, height))
+	d = &font.Drawer{Dst: fg, Src: image.White, Face: face, Dot: dot}
+	d.DrawString(text)
+	draw.Draw(mark, mark.Rect, fg, image.Point{}, draw.Over)
+	return mark, nil
+}
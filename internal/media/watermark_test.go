@@ -0,0 +1,49 @@
+package media
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestWatermark(t *testing.T) {
+	mark, err := TextMark("© imgd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark.Bounds().Dx() <= mark.Bounds().Dy() {
+		t.Fatalf("expected a wide text mark. got %v", mark.Bounds())
+	}
+	img := imaging.New(400, 200, color.NRGBA{0, 0, 0, 255})
+	dst := Watermark(img, WatermarkOptions{Mark: mark, Position: "bottom-right", Opacity: 1, Scale: 0.25})
+	if dst.Rect != img.Rect {
+		t.Fatalf("expected the dimensions to be kept. got %v", dst.Rect)
+	}
+	brightest := func(x0, y0, x1, y1 int) uint8 {
+		max := uint8(0)
+		for x := x0; x < x1; x++ {
+			for y := y0; y < y1; y++ {
+				if c := dst.NRGBAAt(x, y); c.R > max {
+					max = c.R
+				}
+			}
+		}
+		return max
+	}
+	if brightest(300, 150, 400, 200) < 200 {
+		t.Error("expected the watermark in the bottom right corner")
+	}
+	if brightest(0, 0, 200, 100) != 0 {
+		t.Error("expected the rest of the photo to be untouched")
+	}
+	if img.NRGBAAt(390, 190).R != 0 {
+		t.Error("expected the source image to be left alone")
+	}
+}
+
+func TestValidWatermarkPosition(t *testing.T) {
+	if !ValidWatermarkPosition("center") || ValidWatermarkPosition("middle") {
+		t.Error("unexpected position validation")
+	}
+}
@@ -29,6 +29,7 @@ type Client interface {
 	GetLakeBaseURL() string
 	SetLakeName(name string)
 	UploadFile(ctx context.Context, file string, media io.Reader) (string, error)
+	UploadPrivateFile(ctx context.Context, file string, media io.Reader) (string, error)
 	DownloadFile(ctx context.Context, file string) ([]byte, error)
 	RemoveFile(ctx context.Context, file string) error
 	CreateLake(ctx context.Context) error
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"os"
 	"path"
@@ -52,7 +53,20 @@ func New(ctx context.Context, opts ClientOptions) (*Client, error) {
 
 // UploadFile will upload a file to the bucket.
 func (c *Client) UploadFile(ctx context.Context, filename string, media io.Reader) (string, error) {
+	return c.upload(ctx, filename, media, "")
+}
+
+// UploadPrivateFile will upload a file to the bucket which is only readable by the project
+// rather than publicly like the rest of the lake.
+func (c *Client) UploadPrivateFile(ctx context.Context, filename string, media io.Reader) (string, error) {
+	return c.upload(ctx, filename, media, "projectPrivate")
+}
+
+func (c *Client) upload(ctx context.Context, filename string, media io.Reader, acl string) (string, error) {
 	wc := c.client.Bucket(c.GetLakeName()).Object(filename).NewWriter(ctx)
+	wc.PredefinedACL = acl
+	// Stylesheets and scripts are ignored by browsers unless they are served with their type.
+	wc.ContentType = mime.TypeByExtension(path.Ext(filename))
 	if _, err := io.Copy(wc, media); err != nil {
 		return "", fmt.Errorf("io.Copy: %v", err)
 	}
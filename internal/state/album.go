@@ -5,32 +5,216 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/psaia/imgd/internal/media"
 )
 
 // Album represents a collection of photos.
 type Album struct {
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Created     string   `json:"created"`
-	Updated     string   `json:"updated"`
-	Photos      []string `json:"photos"`
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Description      string        `json:"description"`
+	Created          string        `json:"created"`
+	Updated          string        `json:"updated"`
+	Photos           []string      `json:"photos"`
+	Privacy          PrivacyPolicy `json:"privacy,omitempty"`
+	PrivateOriginals bool          `json:"privateOriginals,omitempty"`
+
+	// Cover is the hash of the photo representing the album. The first photo is used when
+	// it is empty.
+	Cover string `json:"cover,omitempty"`
+
+	// Unlisted albums are left out of the index page, feeds and sitemap and ask search
+	// engines not to index them. Anyone with the link can still see them.
+	Unlisted bool `json:"unlisted,omitempty"`
+
+	// PageSize overrides the page size of the workspace for this album.
+	PageSize int `json:"pageSize,omitempty"`
+	// PhotoPages are the photo pages, sizes or PhotoPageResponsive, the photos of the album
+	// were last rendered with.
+	PhotoPages []string `json:"photoPages,omitempty"`
+
+	Watermark   *Watermark        `json:"watermark,omitempty"`
+	Watermarked map[string]string `json:"watermarked,omitempty"`
+	// WatermarkedSizes are the sizes the watermarked copies were last rendered in.
+	WatermarkedSizes []PhotoSizeType `json:"watermarkedSizes,omitempty"`
+
+	// Theme overrides the theme of the workspace for this album.
+	Theme         string            `json:"theme,omitempty"`
+	ThemeSettings map[string]string `json:"themeSettings,omitempty"`
+}
+
+// PrivacyPolicy decides which metadata is published alongside the photos of an album.
+type PrivacyPolicy string
+
+var (
+	// PrivacyKeepAll publishes every piece of metadata, including the location.
+	PrivacyKeepAll PrivacyPolicy = "keep"
+
+	// PrivacyStripLocation publishes everything except the GPS coordinates.
+	PrivacyStripLocation PrivacyPolicy = "strip-location"
+
+	// PrivacyStripAll publishes no metadata at all.
+	PrivacyStripAll PrivacyPolicy = "strip-all"
+)
+
+// ParsePrivacyPolicy validates a policy provided by the user.
+func ParsePrivacyPolicy(s string) (PrivacyPolicy, error) {
+	for _, p := range []PrivacyPolicy{PrivacyKeepAll, PrivacyStripLocation, PrivacyStripAll} {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown privacy policy %q. Use one of: keep, strip-location, strip-all", s)
+}
+
+// StripMode is the media.StripMode for the policy.
+func (p PrivacyPolicy) StripMode() media.StripMode {
+	switch p {
+	case PrivacyKeepAll:
+		return media.StripNone
+	case PrivacyStripLocation:
+		return media.StripLocation
+	default:
+		return media.StripAll
+	}
+}
+
+// stricter is true when the policy publishes less metadata than another one.
+func (p PrivacyPolicy) stricter(o PrivacyPolicy) bool {
+	return p.StripMode() > o.StripMode()
+}
+
+// PrivacyPolicy returns the policy of the album. Albums created before policies existed
+// strip everything since derivatives never carried any metadata.
+func (a Album) PrivacyPolicy() PrivacyPolicy {
+	if a.Privacy == "" {
+		return PrivacyStripAll
+	}
+	return a.Privacy
+}
+
+// KeepsOriginalsPrivate is true when the true originals of the album are kept private and a
+// sanitized copy is published instead. Albums which strip metadata always do, since the
+// original would publish it anyway.
+func (a Album) KeepsOriginalsPrivate() bool {
+	return a.PrivateOriginals || a.PrivacyPolicy() != PrivacyKeepAll
 }
 
 // NewAlbum creates a new album.
 func NewAlbum() Album {
 	return Album{
-		Created: time.Now().String(),
+		Created: Timestamp(),
 		ID:      uuid.New().String(),
 		Photos:  make([]string, 0),
 	}
 }
 
+// CreatedTime is when the album was created.
+func (a Album) CreatedTime() time.Time {
+	return ParseTimestamp(a.Created)
+}
+
+// UpdatedTime is when photos were last added to or removed from the album, or when it was
+// last edited. Albums which were never updated return the time they were created.
+func (a Album) UpdatedTime() time.Time {
+	if a.Updated == "" {
+		return a.CreatedTime()
+	}
+	return ParseTimestamp(a.Updated)
+}
+
+// TouchAlbum marks an album as updated.
+func (s State) TouchAlbum(a Album) State {
+	for idx := range s.Albums {
+		if s.Albums[idx].ID == a.ID {
+			s.Albums[idx].Updated = Timestamp()
+		}
+	}
+	return s
+}
+
+// ListedAlbums are the albums which aren't unlisted.
+func (s State) ListedAlbums() []Album {
+	albums := make([]Album, 0)
+	for _, a := range s.Albums {
+		if !a.Unlisted {
+			albums = append(albums, a)
+		}
+	}
+	return albums
+}
+
+// HasPhoto is true when the photo is part of the album.
+func (a Album) HasPhoto(hash string) bool {
+	for _, h := range a.Photos {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// AlbumCover is the photo representing an album, which is its cover or otherwise its first
+// photo. It returns nil for empty albums.
+func (s State) AlbumCover(a Album) *Photo {
+	if a.Cover != "" && a.HasPhoto(a.Cover) {
+		if p := s.GetPhoto(a.Cover); p != nil {
+			return p
+		}
+	}
+	for _, hash := range a.Photos {
+		if p := s.GetPhoto(hash); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// PublishedMetadata is the metadata of a photo which may be shown publicly in the album
+// according to its privacy policy.
+func (a Album) PublishedMetadata(m media.Metadata) media.Metadata {
+	switch a.PrivacyPolicy() {
+	case PrivacyKeepAll:
+		return m
+	case PrivacyStripLocation:
+		m.Latitude, m.Longitude, m.HasGPS = 0, 0, false
+		return m
+	}
+	return media.Metadata{}
+}
+
+// PublishedPhoto is a photo with only the metadata which may be shown publicly in the album,
+// see PublishedMetadata. Templates only ever see published photos.
+func (a Album) PublishedPhoto(p Photo) Photo {
+	p.Metadata = a.PublishedMetadata(p.Metadata)
+	return p
+}
+
 // PublicSlug is the slug at the end of the URL.
 func (a Album) PublicSlug() string {
 	return fmt.Sprintf("%s.html", a.ID)
 }
 
+// FeedSlug is the slug of the Atom feed of the album.
+func (a Album) FeedSlug() string {
+	return fmt.Sprintf("%s/feed.xml", a.ID)
+}
+
+// FeedURL is the full url of the Atom feed of the album.
+func (a Album) FeedURL(bucketURL string) string {
+	return fmt.Sprintf("%s/%s", bucketURL, a.FeedSlug())
+}
+
+// CatalogueSlug is the slug of the JSON of the album.
+func (a Album) CatalogueSlug() string {
+	return fmt.Sprintf("%s/album.json", a.ID)
+}
+
+// CatalogueURL is the full url of the JSON of the album.
+func (a Album) CatalogueURL(bucketURL string) string {
+	return fmt.Sprintf("%s/%s", bucketURL, a.CatalogueSlug())
+}
+
 // PublicURL is the full HTML url for this album.
 func (a Album) PublicURL(bucketURL string) string {
 	return fmt.Sprintf("%s/%s", bucketURL, a.PublicSlug())
@@ -52,6 +236,16 @@ func (s State) GetAlbum(id string) *Album {
 	return nil
 }
 
+// UpdateAlbum replaces the stored album with the same ID.
+func (s State) UpdateAlbum(a Album) State {
+	for idx := range s.Albums {
+		if s.Albums[idx].ID == a.ID {
+			s.Albums[idx] = a
+		}
+	}
+	return s
+}
+
 // RemoveAlbum will completely remove an album from the state.
 func (s State) RemoveAlbum(a Album) State {
 	for idx, album := range s.Albums {
@@ -84,6 +278,9 @@ func (s State) RemovePhotoFromAlbum(a Album, p Photo) State {
 			for pIdx := range s.Albums[aIdx].Photos {
 				if s.Albums[aIdx].Photos[pIdx] == p.Hash {
 					s.Albums[aIdx].Photos = append(s.Albums[aIdx].Photos[:pIdx], s.Albums[aIdx].Photos[pIdx+1:]...)
+					if s.Albums[aIdx].Cover == p.Hash {
+						s.Albums[aIdx].Cover = ""
+					}
 					return s
 				}
 			}
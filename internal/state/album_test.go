@@ -2,6 +2,8 @@ package state
 
 import (
 	"testing"
+
+	"github.com/psaia/imgd/internal/media"
 )
 
 func TestAddAlbum(t *testing.T) {
@@ -40,6 +42,57 @@ func TestRemovePhotoToAlbum(t *testing.T) {
 	}
 }
 
+func TestAlbumCover(t *testing.T) {
+	st := New()
+	album := NewAlbum()
+	st = st.AddAlbum(album)
+	if st.AlbumCover(album) != nil {
+		t.Fatal("expected an empty album to have no cover")
+	}
+	for _, hash := range []string{"abc", "efg"} {
+		st = st.PersistPhoto(Photo{Hash: hash})
+		st = st.AddPhotoToAlbum(album, Photo{Hash: hash})
+	}
+	if cover := st.AlbumCover(*st.GetAlbum(album.ID)); cover == nil || cover.Hash != "abc" {
+		t.Fatalf("expected the first photo to be the cover. got %v", cover)
+	}
+	album = *st.GetAlbum(album.ID)
+	album.Cover = "efg"
+	st = st.UpdateAlbum(album)
+	if cover := st.AlbumCover(*st.GetAlbum(album.ID)); cover == nil || cover.Hash != "efg" {
+		t.Fatalf("expected the chosen cover. got %v", cover)
+	}
+	st = st.RemovePhotoFromAlbum(album, Photo{Hash: "efg"})
+	if a := st.GetAlbum(album.ID); a.Cover != "" {
+		t.Fatalf("expected the cover to be reset when its photo is removed. got %s", a.Cover)
+	}
+}
+
+func TestListedAlbums(t *testing.T) {
+	listed, unlisted := NewAlbum(), NewAlbum()
+	unlisted.Unlisted = true
+	st := New().AddAlbum(listed).AddAlbum(unlisted)
+	if albums := st.ListedAlbums(); len(albums) != 1 || albums[0].ID != listed.ID {
+		t.Fatalf("expected only the listed album. got %v", albums)
+	}
+}
+
+func TestPublishedMetadata(t *testing.T) {
+	m := media.Metadata{Model: "X100V", Latitude: 52.37, Longitude: 4.89, HasGPS: true}
+	album := NewAlbum()
+	if published := album.PublishedMetadata(m); published.Model != "" {
+		t.Fatalf("expected no metadata by default. got %+v", published)
+	}
+	album.Privacy = PrivacyStripLocation
+	if published := album.PublishedMetadata(m); published.Model != "X100V" || published.HasGPS || published.Latitude != 0 {
+		t.Fatalf("expected everything but the location. got %+v", published)
+	}
+	album.Privacy = PrivacyKeepAll
+	if published := album.PublishedMetadata(m); published != m {
+		t.Fatalf("expected all metadata. got %+v", published)
+	}
+}
+
 func TestRemoveAlbum(t *testing.T) {
 	st := New()
 	album := NewAlbum()
@@ -49,3 +102,138 @@ func TestRemoveAlbum(t *testing.T) {
 		t.Fatalf("expected the album to be removed but it wasn't")
 	}
 }
+
+func TestAlbumPrivacyPolicy(t *testing.T) {
+	album := NewAlbum()
+	if album.PrivacyPolicy() != PrivacyStripAll {
+		t.Fatalf("expected albums without a policy to strip all metadata. got %s", album.PrivacyPolicy())
+	}
+	st := New()
+	photo := Photo{Hash: "abc", Extension: "jpg"}
+	if !st.NeedsRepublish(photo, album) {
+		t.Fatalf("expected photos synced before policies existed to have their originals made private")
+	}
+	if !album.KeepsOriginalsPrivate() || st.NeedsRepublish(Photo{Hash: "abc", Privacy: PrivacyStripAll, PrivateOriginal: true}, album) {
+		t.Fatalf("expected albums which strip metadata to keep their originals private")
+	}
+	if (Album{Privacy: PrivacyKeepAll}).KeepsOriginalsPrivate() {
+		t.Fatalf("expected albums which keep metadata to publish their originals")
+	}
+	album.Privacy = PrivacyStripLocation
+	album.PrivateOriginals = true
+	if !st.NeedsRepublish(photo, album) {
+		t.Fatalf("expected a policy change to require republishing")
+	}
+	photo.PrivateOriginal = true
+	if photo.PublicFilename(PhotoSizeTypeOriginal) != "abc-large.jpg" {
+		t.Fatalf("expected a private original without a sanitized copy to link the large size. got %s", photo.PublicFilename(PhotoSizeTypeOriginal))
+	}
+	photo.PublicOriginal = photo.SanitizedFilename()
+	if photo.PublicFilename(PhotoSizeTypeOriginal) != "abc-public.jpg" {
+		t.Fatalf("expected the sanitized copy to be public. got %s", photo.PublicFilename(PhotoSizeTypeOriginal))
+	}
+	if _, err := ParsePrivacyPolicy("everything"); err == nil {
+		t.Fatalf("expected an unknown policy to be rejected")
+	}
+}
+
+func TestSharedPolicy(t *testing.T) {
+	st := New()
+	keep, strict := NewAlbum(), NewAlbum()
+	keep.Privacy = PrivacyKeepAll
+	strict.PrivateOriginals = true
+	photo := Photo{Hash: "abc", Extension: "jpg"}
+	st = st.AddAlbum(keep)
+	st = st.AddAlbum(strict)
+	st = st.AddPhotoToAlbum(strict, photo)
+
+	policy, private := st.SharedPolicy(photo, keep)
+	if policy != PrivacyStripAll || !private {
+		t.Fatalf("expected the strictest policy of the albums sharing the photo. got %s %v", policy, private)
+	}
+	photo.Privacy, photo.PrivateOriginal = policy, private
+	st = st.AddPhotoToAlbum(keep, photo)
+	if st.NeedsRepublish(photo, keep) || st.NeedsRepublish(photo, strict) {
+		t.Fatalf("expected syncing either album not to flip the policy of the shared files")
+	}
+	st = st.RemovePhotoFromAlbum(strict, photo)
+	if !st.NeedsRepublish(photo, keep) {
+		t.Fatalf("expected the photo to be republished once only the permissive album contains it")
+	}
+}
+
+func TestStaleWatermarkSizes(t *testing.T) {
+	album := NewAlbum()
+	album.Watermark = &Watermark{Text: "imgd", Sizes: []PhotoSizeType{PhotoSizeTypeLarge}}
+	if len(album.StaleWatermarkSizes()) != 0 {
+		t.Fatalf("expected albums without watermarked copies to have no stale sizes")
+	}
+	album.Watermarked = map[string]string{"abc": "sig"}
+	if stale := album.StaleWatermarkSizes(); len(stale) != len(GetPhotoSizeTypes())-2 {
+		t.Fatalf("expected every other size to be stale when the sizes weren't recorded. got %v", stale)
+	}
+	album.WatermarkedSizes = []PhotoSizeType{PhotoSizeTypeMedium, PhotoSizeTypeLarge}
+	if stale := album.StaleWatermarkSizes(); len(stale) != 1 || stale[0] != PhotoSizeTypeMedium {
+		t.Fatalf("expected the medium size to be stale. got %v", stale)
+	}
+}
+
+func TestAlbumWatermark(t *testing.T) {
+	st := New()
+	album := NewAlbum()
+	photo := Photo{Hash: "abc", Extension: "jpg"}
+	if album.NeedsWatermark(photo) || photo.AlbumFilename(album, PhotoSizeTypeLarge) != "abc-large.jpg" {
+		t.Fatalf("expected albums without a watermark to share the derivatives")
+	}
+	album.Watermark = &Watermark{Text: "imgd", Position: "center", Opacity: 0.5, Scale: 0.2, Sizes: []PhotoSizeType{PhotoSizeTypeLarge}}
+	st = st.AddAlbum(album)
+	if !album.NeedsWatermark(photo) {
+		t.Fatalf("expected the photo to need a watermark")
+	}
+	if photo.AlbumFilename(album, PhotoSizeTypeLarge) != album.ID+"/abc-large.jpg" {
+		t.Fatalf("expected the watermarked copy. got %s", photo.AlbumFilename(album, PhotoSizeTypeLarge))
+	}
+	if photo.AlbumFilename(album, PhotoSizeTypeOriginal) != "abc.jpg" {
+		t.Fatalf("expected originals to never be watermarked")
+	}
+	st = st.SetWatermarked(album, photo, album.Watermark.Signature())
+	if st.GetAlbum(album.ID).NeedsWatermark(photo) {
+		t.Fatalf("expected the watermark to be up to date")
+	}
+	changed := *album.Watermark
+	changed.Opacity = 1
+	if changed.Signature() == album.Watermark.Signature() {
+		t.Fatalf("expected the signature to change with the watermark")
+	}
+}
+
+func TestAlbumTheme(t *testing.T) {
+	st := New()
+	st.Workspace = Workspace{Theme: "limpo", ThemeSettings: map[string]string{"accent": "#000", "columns": "4"}}
+	album := NewAlbum()
+	if st.AlbumTheme(album) != "limpo" {
+		t.Fatalf("expected the workspace theme. got %s", st.AlbumTheme(album))
+	}
+	album.Theme = "dark"
+	settings, err := ApplyThemeSettings(nil, []string{"accent=#fff", "exif = false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	album.ThemeSettings = settings
+	if st.AlbumTheme(album) != "dark" {
+		t.Fatalf("expected the album theme. got %s", st.AlbumTheme(album))
+	}
+	merged := st.ThemeSettings(&album)
+	if merged["accent"] != "#fff" || merged["columns"] != "4" || merged["exif"] != "false" {
+		t.Fatalf("expected the album to override the workspace settings. got %v", merged)
+	}
+	if st.ThemeSettings(nil)["accent"] != "#000" {
+		t.Fatalf("expected the index to use the workspace settings")
+	}
+	if settings, _ = ApplyThemeSettings(settings, []string{"accent=", "exif="}); settings != nil {
+		t.Fatalf("expected every setting to be removed. got %v", settings)
+	}
+	if _, err := ApplyThemeSettings(nil, []string{"accent"}); err == nil {
+		t.Fatalf("expected a setting without a value to be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/psaia/imgd/internal/media"
+)
+
+// DefaultDuplicateThreshold is the largest perceptual hash distance at which two photos
+// are considered near duplicates.
+const DefaultDuplicateThreshold = 10
+
+// SimilarPhotos returns every other photo in the workspace which nearly matches p.
+func (s State) SimilarPhotos(p Photo, threshold int) []Photo {
+	photos := make([]Photo, 0)
+	h, err := media.ParsePerceptualHash(p.PerceptualHash)
+	if err != nil {
+		return photos
+	}
+	for _, hash := range s.sortedHashes() {
+		other := s.Hashes[hash]
+		if other.Hash == p.Hash {
+			continue
+		}
+		if oh, err := media.ParsePerceptualHash(other.PerceptualHash); err == nil && h.Distance(oh) <= threshold {
+			photos = append(photos, other)
+		}
+	}
+	return photos
+}
+
+// Duplicates groups the photos of the workspace which nearly match each other. A photo
+// belongs to a group when it nearly matches at least one other photo in it.
+func (s State) Duplicates(threshold int) [][]Photo {
+	hashes := make([]string, 0)
+	phashes := make(map[string]media.PerceptualHash)
+	for _, hash := range s.sortedHashes() {
+		if h, err := media.ParsePerceptualHash(s.Hashes[hash].PerceptualHash); err == nil {
+			hashes = append(hashes, hash)
+			phashes[hash] = h
+		}
+	}
+	// Union-find so chains of near duplicates end up in the same group.
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(h string) string {
+		if parent[h] == "" || parent[h] == h {
+			return h
+		}
+		parent[h] = find(parent[h])
+		return parent[h]
+	}
+	for i, a := range hashes {
+		for _, b := range hashes[i+1:] {
+			if phashes[a].Distance(phashes[b]) <= threshold {
+				parent[find(b)] = find(a)
+			}
+		}
+	}
+	groups := make(map[string][]Photo)
+	roots := make([]string, 0)
+	for _, hash := range hashes {
+		root := find(hash)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], s.Hashes[hash])
+	}
+	duplicates := make([][]Photo, 0)
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			duplicates = append(duplicates, groups[root])
+		}
+	}
+	return duplicates
+}
+
+// PhotoAlbums returns every album a photo belongs to.
+func (s State) PhotoAlbums(p Photo) []Album {
+	albums := make([]Album, 0)
+	for _, a := range s.Albums {
+		for _, hash := range a.Photos {
+			if hash == p.Hash {
+				albums = append(albums, a)
+				break
+			}
+		}
+	}
+	return albums
+}
+
+func (s State) sortedHashes() []string {
+	hashes := make([]string, 0, len(s.Hashes))
+	for hash := range s.Hashes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
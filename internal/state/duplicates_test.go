@@ -0,0 +1,30 @@
+package state
+
+import (
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	st := New()
+	st = st.PersistPhoto(Photo{Hash: "a", PerceptualHash: "ff00ff00ff00ff00"})
+	st = st.PersistPhoto(Photo{Hash: "b", PerceptualHash: "ff00ff00ff00ff0f"})
+	st = st.PersistPhoto(Photo{Hash: "c", PerceptualHash: "ff00ff00ff00f000"})
+	st = st.PersistPhoto(Photo{Hash: "d", PerceptualHash: "00ff00ff00ff00ff"})
+	st = st.PersistPhoto(Photo{Hash: "e"})
+
+	groups := st.Duplicates(4)
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group of duplicates. got %d", len(groups))
+	}
+	// c is 8 bits away from b but only 4 from a, which chains them together.
+	if len(groups[0]) != 3 || groups[0][0].Hash != "a" || groups[0][2].Hash != "c" {
+		t.Fatalf("expected a, b and c to be grouped. got %v", groups[0])
+	}
+	similar := st.SimilarPhotos(*st.GetPhoto("b"), 4)
+	if len(similar) != 1 || similar[0].Hash != "a" {
+		t.Fatalf("expected b to only nearly match a. got %v", similar)
+	}
+	if len(st.SimilarPhotos(*st.GetPhoto("e"), 64)) != 0 {
+		t.Fatalf("expected photos without a perceptual hash to never match")
+	}
+}
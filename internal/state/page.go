@@ -0,0 +1,111 @@
+package state
+
+import "fmt"
+
+// DefaultPageSize is the amount of photos on a page of an album unless the album or the
+// workspace sets it.
+const DefaultPageSize = 100
+
+// PhotoPageResponsive is the single page of a photo which isn't tied to a size. Themes
+// declaring it pick the size in the browser, e.g. with srcset.
+const PhotoPageResponsive = "responsive"
+
+// PhotoPageSize is the size a photo page is rendered with. The responsive page has none.
+func PhotoPageSize(page string) PhotoSizeType {
+	if page == PhotoPageResponsive {
+		return ""
+	}
+	return PhotoSizeType(page)
+}
+
+// ValidPhotoPage reports whether a photo page exists.
+func ValidPhotoPage(page string) bool {
+	return page == PhotoPageResponsive || ValidPhotoSizeType(PhotoSizeType(page))
+}
+
+// PhotoPageSizes are the sizes photo pages are rendered with. Without pages every size has
+// a page.
+func PhotoPageSizes(pages []string) []PhotoSizeType {
+	if len(pages) == 0 {
+		return GetPhotoSizeTypes()
+	}
+	sizes := make([]PhotoSizeType, len(pages))
+	for idx, page := range pages {
+		sizes[idx] = PhotoPageSize(page)
+	}
+	return sizes
+}
+
+// PhotoPageSizes are the sizes the pages of the photos of an album were last rendered with.
+// Albums rendered before themes declared their photo pages have a page for every size.
+func (a Album) PhotoPageSizes() []PhotoSizeType {
+	return PhotoPageSizes(a.PhotoPages)
+}
+
+// PhotoLinkSize is the size of the photo page the album page links to.
+func (a Album) PhotoLinkSize() PhotoSizeType {
+	if len(a.PhotoPages) == 0 {
+		return PhotoSizeTypeLarge
+	}
+	return PhotoPageSize(a.PhotoPages[0])
+}
+
+// AlbumPageSize is the amount of photos on each page of an album.
+func (s State) AlbumPageSize(a Album) int {
+	if a.PageSize > 0 {
+		return a.PageSize
+	}
+	if s.Workspace.PageSize > 0 {
+		return s.Workspace.PageSize
+	}
+	return DefaultPageSize
+}
+
+// AlbumPages is the amount of pages of an album. Empty albums still have a single page.
+func (s State) AlbumPages(a Album) int {
+	size := s.AlbumPageSize(a)
+	pages := (len(a.Photos) + size - 1) / size
+	if pages < 1 {
+		return 1
+	}
+	return pages
+}
+
+// AlbumPagePhotos are the hashes of the photos on a page of an album, starting at page 1.
+func (s State) AlbumPagePhotos(a Album, page int) []string {
+	size := s.AlbumPageSize(a)
+	start := (page - 1) * size
+	if page < 1 || start >= len(a.Photos) {
+		return []string{}
+	}
+	end := start + size
+	if end > len(a.Photos) {
+		end = len(a.Photos)
+	}
+	return a.Photos[start:end]
+}
+
+// PhotoPage is the page of an album a photo is listed on. It is 1 for photos which aren't
+// part of the album.
+func (s State) PhotoPage(a Album, hash string) int {
+	for idx, h := range a.Photos {
+		if h == hash {
+			return idx/s.AlbumPageSize(a) + 1
+		}
+	}
+	return 1
+}
+
+// PageSlug is the slug of a page of an album. The first page is the album's PublicSlug so
+// existing links keep working.
+func (a Album) PageSlug(page int) string {
+	if page <= 1 {
+		return a.PublicSlug()
+	}
+	return fmt.Sprintf("%s/page-%d.html", a.ID, page)
+}
+
+// PageURL is the full HTML url of a page of an album.
+func (a Album) PageURL(bucketURL string, page int) string {
+	return fmt.Sprintf("%s/%s", bucketURL, a.PageSlug(page))
+}
@@ -0,0 +1,41 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlbumPages(t *testing.T) {
+	st := New()
+	album := NewAlbum()
+	st = st.AddAlbum(album)
+	if pages := st.AlbumPages(album); pages != 1 {
+		t.Fatalf("expected an empty album to have 1 page. got %d", pages)
+	}
+	for _, hash := range []string{"a", "b", "c", "d", "e"} {
+		st = st.AddPhotoToAlbum(album, Photo{Hash: hash})
+	}
+	album = *st.GetAlbum(album.ID)
+	album.PageSize = 2
+	if pages := st.AlbumPages(album); pages != 3 {
+		t.Fatalf("expected 3 pages. got %d", pages)
+	}
+	if photos := st.AlbumPagePhotos(album, 3); !reflect.DeepEqual(photos, []string{"e"}) {
+		t.Fatalf("expected the last page to hold the last photo. got %v", photos)
+	}
+	if photos := st.AlbumPagePhotos(album, 4); len(photos) != 0 {
+		t.Fatalf("expected no photos past the last page. got %v", photos)
+	}
+	if page := st.PhotoPage(album, "c"); page != 2 {
+		t.Fatalf("expected c to be on page 2. got %d", page)
+	}
+	if album.PageSlug(1) != album.PublicSlug() {
+		t.Fatalf("expected the first page to keep the slug of the album. got %s", album.PageSlug(1))
+	}
+
+	st.Workspace.PageSize = 4
+	album.PageSize = 0
+	if pages := st.AlbumPages(album); pages != 2 {
+		t.Fatalf("expected the page size of the workspace to be used. got %d pages", pages)
+	}
+}
@@ -5,18 +5,48 @@ import (
 	"io/ioutil"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/h2non/filetype"
 	"github.com/h2non/filetype/types"
 	"github.com/psaia/imgd/internal/fs"
+	"github.com/psaia/imgd/internal/media"
 )
 
 // Photo represents a photograph.
 type Photo struct {
-	Name      string `json:"name"`
-	Extension string `json:"ext"`
-	Hash      string `json:"hash"`
+	Name      string         `json:"name"`
+	Extension string         `json:"ext"`
+	Hash      string         `json:"hash"`
+	Metadata  media.Metadata `json:"meta"`
+	Caption   string         `json:"caption,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+
+	// The privacy policy the published files were generated with.
+	Privacy         PrivacyPolicy `json:"privacy,omitempty"`
+	PrivateOriginal bool          `json:"privateOriginal,omitempty"`
+	PublicOriginal  string        `json:"publicOriginal,omitempty"`
+
+	// FocalPoint is set manually when the automatic crop misses the subject.
+	FocalPoint *FocalPoint `json:"focalPoint,omitempty"`
+
+	// Placeholder is shown by themes while the photo is loading.
+	Placeholder media.Placeholder `json:"placeholder"`
+
+	// PerceptualHash is used to find near duplicates, see media.PerceptualHash.
+	PerceptualHash string `json:"phash,omitempty"`
+
+	// Added is when the photo was first synced.
+	Added string `json:"added,omitempty"`
+}
+
+// FocalPoint is a position relative to the (oriented) photo, 0..1 on both axes, which
+// cropped sizes are centered on.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 // PhotoSizeType represents each image size.
@@ -50,8 +80,57 @@ func (p Photo) RawFilename(size PhotoSizeType) string {
 	return fmt.Sprintf("%s-%s.%s", p.Hash, string(size), "jpg")
 }
 
-// PublicSlug generates the html version of a file.
+// PublicFilename is the name of the publicly readable file for a size. When the original
+// is private, its sanitized copy is used, or the largest derivative if there is none.
+func (p Photo) PublicFilename(size PhotoSizeType) string {
+	if size == PhotoSizeTypeOriginal && p.PrivateOriginal {
+		if p.PublicOriginal != "" {
+			return p.PublicOriginal
+		}
+		return p.RawFilename(PhotoSizeTypeLarge)
+	}
+	return p.RawFilename(size)
+}
+
+// SanitizedFilename is the name of the public copy of a private original.
+func (p Photo) SanitizedFilename() string {
+	return fmt.Sprintf("%s-public.%s", p.Hash, p.Extension)
+}
+
+// SharedPolicy is the privacy policy the files of a photo are published with when it is
+// synced to an album. The derivatives and the original are shared by every album containing
+// the photo, so the strictest policy of these albums wins and the original stays private
+// when any of them keeps originals private, see Album.KeepsOriginalsPrivate.
+func (s State) SharedPolicy(p Photo, a Album) (PrivacyPolicy, bool) {
+	policy, private := a.PrivacyPolicy(), a.KeepsOriginalsPrivate()
+	for _, other := range s.PhotoAlbums(p) {
+		if other.ID == a.ID {
+			continue
+		}
+		if other.PrivacyPolicy().stricter(policy) {
+			policy = other.PrivacyPolicy()
+		}
+		private = private || other.KeepsOriginalsPrivate()
+	}
+	return policy, private
+}
+
+// NeedsRepublish is true when the published files of a photo were generated with a
+// different privacy policy than the one it should be shared with, see SharedPolicy.
+func (s State) NeedsRepublish(p Photo, a Album) bool {
+	applied := p.Privacy
+	if applied == "" {
+		applied = PrivacyStripAll
+	}
+	policy, private := s.SharedPolicy(p, a)
+	return applied != policy || p.PrivateOriginal != private
+}
+
+// PublicSlug generates the html version of a file. Without a size it is the responsive page.
 func (p Photo) PublicSlug(a Album, size PhotoSizeType) string {
+	if size == "" {
+		return fmt.Sprintf("%s/%s.html", a.ID, p.Hash)
+	}
 	return fmt.Sprintf("%s/%s-%s.html", a.ID, p.Hash, string(size))
 }
 
@@ -62,7 +141,7 @@ func (p Photo) PublicURL(bucketURL string, a Album, size PhotoSizeType) string {
 
 // PublicURLRaw generates the url for the actual image file.
 func (p Photo) PublicURLRaw(bucketURL string, size PhotoSizeType) string {
-	return fmt.Sprintf("%s/%s", bucketURL, p.RawFilename(size))
+	return fmt.Sprintf("%s/%s", bucketURL, p.PublicFilename(size))
 }
 
 // MarshalPhotoFromSrc will create a photo object from a src path. If the
@@ -79,14 +158,102 @@ func (s State) MarshalPhotoFromSrc(src string) (Photo, bool, error) {
 	if persistedPhoto := s.GetPhoto(hash); persistedPhoto != nil {
 		return *persistedPhoto, true, nil
 	}
+	meta, err := media.ReadMetadataFile(src)
+	if err != nil {
+		return Photo{}, false, err
+	}
 	name := path.Base(src)
 	return Photo{
 		Name:      strings.TrimSuffix(name, filepath.Ext(name)),
 		Extension: ft.Extension,
 		Hash:      hash,
+		Metadata:  meta,
+		Added:     Timestamp(),
 	}, false, nil
 }
 
+// AddedTime is when the photo was first synced. It is the zero time for photos synced
+// before it was recorded.
+func (p Photo) AddedTime() time.Time {
+	return ParseTimestamp(p.Added)
+}
+
+// Dimensions are the pixel dimensions of a size of the photo. Both are 0 when the dimensions
+// of the original are unknown.
+func (p Photo) Dimensions(size PhotoSizeType) (int, int) {
+	w, h := p.Metadata.DisplayWidth(), p.Metadata.DisplayHeight()
+	dim := GetPhotoDim(size)
+	switch {
+	case w == 0 || h == 0:
+		return 0, 0
+	case size == PhotoSizeTypeOriginal:
+		return w, h
+	case dim[2] == 1:
+		return dim[0], dim[1]
+	case w <= dim[0] && h <= dim[1]:
+		// Smaller photos are never enlarged.
+		return w, h
+	}
+	// Matches the rounding of imaging.Fit.
+	aspect := float64(w) / float64(h)
+	if aspect > float64(dim[0])/float64(dim[1]) {
+		return dim[0], int(float64(dim[0])/aspect + 0.5)
+	}
+	return int(float64(dim[1])*aspect + 0.5), dim[1]
+}
+
+// Tag adds tags to the photo. Tags are lowercase and kept sorted without duplicates.
+func (p Photo) Tag(tags ...string) Photo {
+	set := make(map[string]bool)
+	for _, tag := range p.Tags {
+		set[tag] = true
+	}
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			set[tag] = true
+		}
+	}
+	p.Tags = make([]string, 0, len(set))
+	for tag := range set {
+		p.Tags = append(p.Tags, tag)
+	}
+	sort.Strings(p.Tags)
+	return p
+}
+
+// Untag removes tags from the photo.
+func (p Photo) Untag(tags ...string) Photo {
+	remove := make(map[string]bool)
+	for _, tag := range tags {
+		remove[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+	kept := make([]string, 0, len(p.Tags))
+	for _, tag := range p.Tags {
+		if !remove[tag] {
+			kept = append(kept, tag)
+		}
+	}
+	p.Tags = kept
+	return p
+}
+
+// Analyzed is false when anything derived from the pixels of the original is missing.
+func (p Photo) Analyzed() bool {
+	return !p.Placeholder.Empty() && p.PerceptualHash != ""
+}
+
+// PhotosNeedingBackfill returns every persisted photo which was added before
+// metadata extraction, placeholders or perceptual hashes existed.
+func (s State) PhotosNeedingBackfill() []Photo {
+	photos := make([]Photo, 0)
+	for _, photo := range s.Hashes {
+		if !photo.Metadata.Extracted || !photo.Analyzed() {
+			photos = append(photos, photo)
+		}
+	}
+	return photos
+}
+
 // PersistPhoto will store a new photo hash.
 func (s State) PersistPhoto(photo Photo) State {
 	s.Hashes[photo.Hash] = photo
@@ -134,6 +301,27 @@ func GetPhotoSizeTypes() []PhotoSizeType {
 	}
 }
 
+// ValidPhotoSizeType reports whether a size exists.
+func ValidPhotoSizeType(size PhotoSizeType) bool {
+	for _, s := range GetPhotoSizeTypes() {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFillPhotoSizeTypes returns the sizes which are cropped to fill their dimensions.
+func GetFillPhotoSizeTypes() []PhotoSizeType {
+	sizes := make([]PhotoSizeType, 0)
+	for _, size := range GetPhotoSizeTypes() {
+		if GetPhotoDim(size)[2] == 1 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
 // GetPhotoDim gets the size based on the size type.
 // w, h, fit|contrain (1 | 0)
 func GetPhotoDim(sizeType PhotoSizeType) []int {
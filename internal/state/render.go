@@ -0,0 +1,33 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// RenderHash identifies the content of a rendered page. It only needs to tell versions of a
+// page apart so it is kept short to keep the state small.
+func RenderHash(html []byte) string {
+	sum := sha256.Sum256(html)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RenderChanged is true unless the page was last uploaded with the same content.
+func (s State) RenderChanged(slug, hash string) bool {
+	return s.Rendered[slug] != hash
+}
+
+// SetRendered records the content of an uploaded page.
+func (s State) SetRendered(slug, hash string) State {
+	if s.Rendered == nil {
+		s.Rendered = make(map[string]string)
+	}
+	s.Rendered[slug] = hash
+	return s
+}
+
+// RemoveRendered forgets a page which was removed from the lake.
+func (s State) RemoveRendered(slug string) State {
+	delete(s.Rendered, slug)
+	return s
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/psaia/imgd/internal/provider"
@@ -18,11 +20,38 @@ type State struct {
 	LakeName string           `json:"lakeName"`
 	Hashes   map[string]Photo `json:"_ph"`
 	Albums   []Album          `json:"albums"`
+
+	Workspace Workspace `json:"workspace"`
+
+	// Rendered maps the slug of every uploaded page to the RenderHash of its content.
+	Rendered map[string]string `json:"rendered,omitempty"`
 }
 
 // StateFile declares where the statefile should be saved.
 const StateFile = ".imgd.state"
 
+// legacyTimeLayout is how timestamps were stored before RFC 3339 was used.
+const legacyTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// Timestamp is the current time as it is stored in the state.
+func Timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// ParseTimestamp parses a timestamp from the state. It returns the zero time for
+// timestamps which are empty or can't be parsed.
+func ParseTimestamp(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	// time.Time.String() adds the monotonic clock reading which can't be parsed.
+	if idx := strings.Index(s, " m="); idx != -1 {
+		s = s[:idx]
+	}
+	t, _ := time.Parse(legacyTimeLayout, s)
+	return t
+}
+
 // New creates a new State.
 func New() State {
 	return State{
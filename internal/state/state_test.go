@@ -0,0 +1,59 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/psaia/imgd/internal/media"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	legacy := ParseTimestamp("2021-01-02 15:04:05.123456789 -0500 EST m=+0.000123")
+	if legacy.IsZero() || legacy.UTC().Hour() != 20 {
+		t.Fatalf("expected legacy timestamps to be parsed. got %v", legacy)
+	}
+	now := ParseTimestamp(Timestamp())
+	if time.Since(now) > time.Minute {
+		t.Fatalf("expected the current time. got %v", now)
+	}
+	if !ParseTimestamp("").IsZero() {
+		t.Fatalf("expected an empty timestamp to be the zero time")
+	}
+}
+
+func TestPhotoDimensions(t *testing.T) {
+	p := Photo{Metadata: media.Metadata{Width: 4000, Height: 3000}}
+	if w, h := p.Dimensions(PhotoSizeTypeMedium); w != 1400 || h != 1050 {
+		t.Fatalf("expected 1400x1050. got %dx%d", w, h)
+	}
+	if w, h := p.Dimensions(PhotoSizeTypeThumbCropped); w != 250 || h != 250 {
+		t.Fatalf("expected the cropped size to be filled. got %dx%d", w, h)
+	}
+	if w, h := p.Dimensions(PhotoSizeTypeLarge); w != 3500 || h != 2625 {
+		t.Fatalf("expected 3500x2625. got %dx%d", w, h)
+	}
+	// Rotated 90 degrees.
+	p.Metadata.Orientation = 6
+	if w, h := p.Dimensions(PhotoSizeTypeOriginal); w != 3000 || h != 4000 {
+		t.Fatalf("expected the orientation to be applied. got %dx%d", w, h)
+	}
+	p.Metadata = media.Metadata{Width: 500, Height: 400}
+	if w, h := p.Dimensions(PhotoSizeTypeSmall); w != 500 || h != 400 {
+		t.Fatalf("expected small photos to not be enlarged. got %dx%d", w, h)
+	}
+	if w, h := (Photo{}).Dimensions(PhotoSizeTypeSmall); w != 0 || h != 0 {
+		t.Fatalf("expected unknown dimensions. got %dx%d", w, h)
+	}
+}
+
+func TestPhotoTags(t *testing.T) {
+	p := Photo{}.Tag("Beach", " sunset ", "beach", "")
+	if strings.Join(p.Tags, ",") != "beach,sunset" {
+		t.Fatalf("expected normalized tags without duplicates. got %v", p.Tags)
+	}
+	p = p.Untag("BEACH", "missing")
+	if strings.Join(p.Tags, ",") != "sunset" {
+		t.Fatalf("expected beach to be removed. got %v", p.Tags)
+	}
+}
@@ -0,0 +1,74 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Workspace holds the defaults of every album in the workspace.
+type Workspace struct {
+	Title         string            `json:"title,omitempty"`
+	Theme         string            `json:"theme,omitempty"`
+	ThemeSettings map[string]string `json:"themeSettings,omitempty"`
+	// PageSize is the amount of photos on each page of an album. Zero is DefaultPageSize.
+	PageSize int `json:"pageSize,omitempty"`
+	// Robots replaces the generated rules of robots.txt when it isn't empty.
+	Robots string `json:"robots,omitempty"`
+}
+
+// AlbumTheme is the name of the theme an album is rendered with. An empty name is the
+// default theme.
+func (s State) AlbumTheme(a Album) string {
+	if a.Theme != "" {
+		return a.Theme
+	}
+	return s.Workspace.Theme
+}
+
+// ThemeSettings are the settings of the workspace with the overrides of the album applied.
+// The index page, which doesn't belong to an album, passes nil.
+func (s State) ThemeSettings(a *Album) map[string]string {
+	settings := make(map[string]string)
+	for k, v := range s.Workspace.ThemeSettings {
+		settings[k] = v
+	}
+	if a != nil {
+		for k, v := range a.ThemeSettings {
+			settings[k] = v
+		}
+	}
+	return settings
+}
+
+// ParseThemeSetting parses a key=value pair provided by the user. An empty value removes
+// the setting.
+func ParseThemeSetting(s string) (string, string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("theme settings must look like key=value. got %q", s)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// ApplyThemeSettings parses key=value pairs into a copy of the settings.
+func ApplyThemeSettings(settings map[string]string, pairs []string) (map[string]string, error) {
+	applied := make(map[string]string)
+	for k, v := range settings {
+		applied[k] = v
+	}
+	for _, pair := range pairs {
+		k, v, err := ParseThemeSetting(pair)
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			delete(applied, k)
+		} else {
+			applied[k] = v
+		}
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+	return applied, nil
+}
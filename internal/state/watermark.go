@@ -0,0 +1,112 @@
+package state
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+)
+
+// Watermark is drawn onto the derivatives of an album. Originals are never watermarked.
+type Watermark struct {
+	Text     string          `json:"text,omitempty"`
+	Image    string          `json:"image,omitempty"`
+	Position string          `json:"position"`
+	Opacity  float64         `json:"opacity"`
+	Scale    float64         `json:"scale"`
+	Sizes    []PhotoSizeType `json:"sizes"`
+}
+
+// WatermarkImageFilename is where an uploaded watermark image is kept in the lake.
+func WatermarkImageFilename(hash, ext string) string {
+	return fmt.Sprintf("_watermarks/%s.%s", hash, ext)
+}
+
+// Signature changes whenever anything affecting the rendered watermark changes.
+func (w Watermark) Signature() string {
+	b, _ := json.Marshal(w)
+	return fmt.Sprintf("%x", sha1.Sum(b))
+}
+
+// Applies is true when the watermark should be drawn on a size.
+func (w *Watermark) Applies(size PhotoSizeType) bool {
+	if w == nil || size == PhotoSizeTypeOriginal {
+		return false
+	}
+	for _, s := range w.Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// AlbumFilename is the name of the file a size of a photo is published as within an album.
+// Watermarked sizes are scoped to the album since the same photo may be shared by
+// other albums without a watermark.
+func (p Photo) AlbumFilename(a Album, size PhotoSizeType) string {
+	if a.Watermark.Applies(size) {
+		return p.WatermarkedFilename(a, size)
+	}
+	return p.PublicFilename(size)
+}
+
+// WatermarkedFilename is the name of the watermarked copy of a size within an album.
+func (p Photo) WatermarkedFilename(a Album, size PhotoSizeType) string {
+	return fmt.Sprintf("%s/%s-%s.%s", a.ID, p.Hash, string(size), "jpg")
+}
+
+// PublicURLRawInAlbum generates the url for the image file as published within an album.
+func (p Photo) PublicURLRawInAlbum(bucketURL string, a Album, size PhotoSizeType) string {
+	return fmt.Sprintf("%s/%s", bucketURL, p.AlbumFilename(a, size))
+}
+
+// NeedsWatermark is true when the watermarked sizes of a photo are missing or outdated.
+func (a Album) NeedsWatermark(p Photo) bool {
+	return a.Watermark != nil && a.Watermarked[p.Hash] != a.Watermark.Signature()
+}
+
+// SetWatermarked records which watermark the album's copies of a photo were rendered with.
+// An empty signature means the photo no longer has any watermarked copies.
+func (s State) SetWatermarked(a Album, p Photo, signature string) State {
+	for idx := range s.Albums {
+		if s.Albums[idx].ID != a.ID {
+			continue
+		}
+		if signature == "" {
+			delete(s.Albums[idx].Watermarked, p.Hash)
+			continue
+		}
+		if s.Albums[idx].Watermarked == nil {
+			s.Albums[idx].Watermarked = make(map[string]string)
+		}
+		s.Albums[idx].Watermarked[p.Hash] = signature
+	}
+	return s
+}
+
+// StaleWatermarkSizes are the sizes which have watermarked copies the watermark no longer
+// applies to, e.g. after changing its sizes. Albums which didn't record their sizes yet may
+// have copies of every size.
+func (a Album) StaleWatermarkSizes() []PhotoSizeType {
+	previous := a.WatermarkedSizes
+	if previous == nil && len(a.Watermarked) > 0 {
+		previous = GetPhotoSizeTypes()[1:]
+	}
+	stale := make([]PhotoSizeType, 0)
+	for _, size := range previous {
+		if !a.Watermark.Applies(size) {
+			stale = append(stale, size)
+		}
+	}
+	return stale
+}
+
+// SetWatermarkedSizes records the sizes the watermarked copies of an album are rendered in.
+func (s State) SetWatermarkedSizes(a Album, sizes []PhotoSizeType) State {
+	for idx := range s.Albums {
+		if s.Albums[idx].ID == a.ID {
+			s.Albums[idx].WatermarkedSizes = sizes
+		}
+	}
+	return s
+}
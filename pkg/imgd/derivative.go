@@ -0,0 +1,98 @@
+package imgd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/state"
+)
+
+// RenderDerivative resizes the raw bytes of an original into a jpeg for the given size. The
+// watermark is optional.
+func RenderDerivative(raw []byte, photo Photo, size PhotoSizeType, wm *media.WatermarkOptions) ([]byte, error) {
+	src, err := imaging.Decode(bytes.NewReader(raw), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+	dim := state.GetPhotoDim(size)
+	var dst *image.NRGBA
+	if dim[2] == 1 {
+		fx, fy := focalPoint(src, photo, float64(dim[0])/float64(dim[1]))
+		dst = media.FillFocus(src, dim[0], dim[1], fx, fy, imaging.Lanczos)
+	} else {
+		dst = imaging.Fit(src, dim[0], dim[1], imaging.Lanczos)
+	}
+	// Derivatives are converted to sRGB since browsers assume it for untagged images.
+	dst, profile := media.ColorManage(dst, raw)
+	if wm != nil {
+		dst = media.Watermark(dst, *wm)
+	}
+	buf := &bytes.Buffer{}
+	if err = imaging.Encode(buf, dst, imaging.JPEG); err != nil {
+		return nil, err
+	}
+	b := media.EmbedICCProfile(buf.Bytes(), profile)
+	return media.CopyExif(raw, b, photo.Privacy.StripMode())
+}
+
+// AnalyzeOriginal fills in whatever is missing of what's derived from the pixels of an
+// original: the loading placeholders and the perceptual hash.
+func AnalyzeOriginal(raw []byte, photo *Photo) error {
+	src, err := imaging.Decode(bytes.NewReader(raw), imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+	// Neither needs any detail so everything is computed from a small copy.
+	small := imaging.Fit(src, 64, 64, imaging.Box)
+	if photo.Placeholder.Empty() {
+		dst, _ := media.ColorManage(small, raw)
+		if photo.Placeholder, err = media.NewPlaceholder(dst); err != nil {
+			return err
+		}
+	}
+	if photo.PerceptualHash == "" {
+		photo.PerceptualHash = media.NewPerceptualHash(small).String()
+	}
+	return nil
+}
+
+// LoadWatermark prepares the watermark of an album so it can be drawn onto derivatives.
+func LoadWatermark(ctx context.Context, client Client, w *state.Watermark) (*media.WatermarkOptions, error) {
+	if w == nil {
+		return nil, nil
+	}
+	opts := &media.WatermarkOptions{
+		Position: w.Position,
+		Opacity:  w.Opacity,
+		Scale:    w.Scale,
+	}
+	if w.Image != "" {
+		b, err := client.DownloadFile(ctx, w.Image)
+		if err != nil {
+			return nil, fmt.Errorf("could not download watermark image: %v", err)
+		}
+		if opts.Mark, err = imaging.Decode(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("could not decode watermark image: %v", err)
+		}
+		return opts, nil
+	}
+	mark, err := media.TextMark(w.Text)
+	if err != nil {
+		return nil, err
+	}
+	opts.Mark = mark
+	return opts, nil
+}
+
+// focalPoint is the manually chosen focal point of a photo, otherwise the most
+// interesting region of the photo is used.
+func focalPoint(src image.Image, photo Photo, aspect float64) (float64, float64) {
+	if photo.FocalPoint != nil {
+		return photo.FocalPoint.X, photo.FocalPoint.Y
+	}
+	return media.SmartFocalPoint(src, aspect)
+}
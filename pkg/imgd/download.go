@@ -0,0 +1,76 @@
+package imgd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/psaia/imgd/internal/state"
+	"golang.org/x/sync/semaphore"
+)
+
+// downloadJob is an original which will be downloaded.
+type downloadJob struct {
+	photo    state.Photo
+	filename string
+	dstPath  string
+}
+
+// DownloadFilename is the name an original is downloaded as.
+func DownloadFilename(p Photo) string {
+	return fmt.Sprintf("%s.%s", p.Name, p.Extension)
+}
+
+// DownloadAlbum downloads the originals of an album into a directory.
+func (w *Workspace) DownloadAlbum(ctx context.Context, albumID, dir string) []error {
+	album, err := w.Album(albumID)
+	if err != nil {
+		return []error{err}
+	}
+	jobs := make([]downloadJob, 0)
+	for _, hash := range album.Photos {
+		photo := w.State.GetPhoto(hash)
+		if photo != nil {
+			jobs = append(jobs, downloadJob{
+				photo:    *photo,
+				filename: photo.RawFilename(state.PhotoSizeTypeOriginal),
+				dstPath:  filepath.Join(dir, DownloadFilename(*photo)),
+			})
+		}
+	}
+
+	var mu sync.Mutex
+	errors := make([]error, 0)
+	maxWorkers := 20
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+
+	for _, job := range jobs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			w.debugf("Failed to acquire semaphore: %v", err)
+			break
+		}
+		go func(j downloadJob) {
+			defer sem.Release(1)
+			bytes, err := w.Client.DownloadFile(ctx, j.filename)
+			if err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			if err := ioutil.WriteFile(j.dstPath, bytes, 0755); err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			w.emit(Event{Kind: EventDownloaded, Album: album.ID, Photo: j.photo, Size: state.PhotoSizeTypeOriginal, File: j.filename})
+		}(job)
+	}
+	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
+		w.debugf("Failed to acquire semaphore: %v", err)
+	}
+	return errors
+}
@@ -0,0 +1,98 @@
+package imgd
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Operations a DryRunClient records.
+const (
+	OpUpload        = "upload"
+	OpUploadPrivate = "upload-private"
+	OpRemove        = "remove"
+	OpCreateLake    = "create-lake"
+	OpRemoveLake    = "remove-lake"
+)
+
+// PlannedOp is a change a DryRunClient kept from reaching the lake.
+type PlannedOp struct {
+	Op   string
+	File string
+}
+
+// DryRunClient records the files an operation would upload and remove instead of changing
+// the lake. Everything else, e.g. downloading files, is passed to the client it wraps. A
+// Workspace with a DryRunClient doesn't save its state locally either.
+type DryRunClient struct {
+	Client
+
+	mu  sync.Mutex
+	ops []PlannedOp
+}
+
+// NewDryRunClient wraps a client.
+func NewDryRunClient(client Client) *DryRunClient {
+	return &DryRunClient{Client: client}
+}
+
+// Planned lists the recorded operations sorted by operation and file. A file is listed once
+// per operation even when it was written several times.
+func (d *DryRunClient) Planned() []PlannedOp {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen := make(map[PlannedOp]bool)
+	ops := make([]PlannedOp, 0, len(d.ops))
+	for _, op := range d.ops {
+		if !seen[op] {
+			seen[op] = true
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Op != ops[j].Op {
+			return ops[i].Op < ops[j].Op
+		}
+		return ops[i].File < ops[j].File
+	})
+	return ops
+}
+
+func (d *DryRunClient) record(op, file string) {
+	d.mu.Lock()
+	d.ops = append(d.ops, PlannedOp{Op: op, File: file})
+	d.mu.Unlock()
+}
+
+// UploadFile records the upload and discards the media.
+func (d *DryRunClient) UploadFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	d.record(OpUpload, file)
+	_, err := io.Copy(ioutil.Discard, media)
+	return d.GetLakeBaseURL() + "/" + file, err
+}
+
+// UploadPrivateFile records the upload and discards the media.
+func (d *DryRunClient) UploadPrivateFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	d.record(OpUploadPrivate, file)
+	_, err := io.Copy(ioutil.Discard, media)
+	return d.GetLakeBaseURL() + "/" + file, err
+}
+
+// RemoveFile records the removal.
+func (d *DryRunClient) RemoveFile(ctx context.Context, file string) error {
+	d.record(OpRemove, file)
+	return nil
+}
+
+// CreateLake records the creation of the lake.
+func (d *DryRunClient) CreateLake(ctx context.Context) error {
+	d.record(OpCreateLake, d.GetLakeName())
+	return nil
+}
+
+// RemoveLake records the removal of the lake.
+func (d *DryRunClient) RemoveLake(ctx context.Context) {
+	d.record(OpRemoveLake, d.GetLakeName())
+}
@@ -0,0 +1,119 @@
+package imgd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+// lakeClient is a client whose lake can't be changed, so tests fail when a dry run
+// reaches it.
+type lakeClient struct {
+	t *testing.T
+	// remote is the state stored in the lake.
+	remote []byte
+}
+
+func (c lakeClient) FindLakeName(ctx context.Context) (string, error) { return "lake", nil }
+func (c lakeClient) GetLakeName() string                              { return "lake" }
+func (c lakeClient) GetLakeBaseURL() string                           { return "https://lake.test" }
+func (c lakeClient) SetLakeName(name string)                          {}
+func (c lakeClient) DownloadFile(ctx context.Context, file string) ([]byte, error) {
+	if file == state.StateFile && c.remote != nil {
+		return c.remote, nil
+	}
+	return nil, nil
+}
+func (c lakeClient) UploadFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	c.t.Fatalf("uploaded %s", file)
+	return "", nil
+}
+func (c lakeClient) UploadPrivateFile(ctx context.Context, file string, media io.Reader) (string, error) {
+	c.t.Fatalf("uploaded %s", file)
+	return "", nil
+}
+func (c lakeClient) RemoveFile(ctx context.Context, file string) error {
+	c.t.Fatalf("removed %s", file)
+	return nil
+}
+func (c lakeClient) CreateLake(ctx context.Context) error {
+	c.t.Fatalf("created the lake")
+	return nil
+}
+func (c lakeClient) RemoveLake(ctx context.Context) {
+	c.t.Fatalf("removed the lake")
+}
+
+func TestDryRunClient(t *testing.T) {
+	ctx := context.Background()
+	dryRun := NewDryRunClient(lakeClient{t: t})
+	dryRun.UploadFile(ctx, "b.html", strings.NewReader("b"))
+	dryRun.UploadFile(ctx, "b.html", strings.NewReader("b"))
+	dryRun.UploadPrivateFile(ctx, "a.jpg", strings.NewReader("a"))
+	dryRun.RemoveFile(ctx, "c.jpg")
+
+	planned := dryRun.Planned()
+	expected := []PlannedOp{{OpRemove, "c.jpg"}, {OpUpload, "b.html"}, {OpUploadPrivate, "a.jpg"}}
+	if len(planned) != len(expected) {
+		t.Fatalf("expected %v. got %v", expected, planned)
+	}
+	for i := range expected {
+		if planned[i] != expected[i] {
+			t.Fatalf("expected %v. got %v", expected, planned)
+		}
+	}
+}
+
+func TestDryRunSave(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	dryRun := NewDryRunClient(lakeClient{t: t})
+	w := &Workspace{Client: dryRun, State: state.New()}
+	if err := w.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(state.StateFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the state not to be saved locally. got %v", err)
+	}
+	if planned := dryRun.Planned(); len(planned) != 1 || planned[0].File != state.StateFile {
+		t.Fatalf("expected the upload of the state to be recorded. got %v", planned)
+	}
+}
+
+func TestDryRunOpen(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	remote, err := json.Marshal(state.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := Open(context.Background(), NewDryRunClient(lakeClient{t: t, remote: remote}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.State.ID == "" {
+		t.Fatal("expected the remote state to be opened")
+	}
+	if _, err := os.Stat(state.StateFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the remote state not to be saved locally. got %v", err)
+	}
+}
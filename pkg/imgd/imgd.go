@@ -0,0 +1,159 @@
+// Package imgd drives a lake programmatically: syncing, removing and downloading albums
+// the way the imgd command does, without prompts or terminal output. The command is a thin
+// wrapper around it.
+package imgd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+)
+
+// Aliases of the types a Workspace works with, so programs outside of this module can
+// name them.
+type (
+	// Client is the storage provider of a lake.
+	Client = provider.Client
+	// State is everything imgd knows about a lake.
+	State = state.State
+	// Album is a collection of photos.
+	Album = state.Album
+	// Photo is a photo shared by any number of albums.
+	Photo = state.Photo
+	// PhotoSizeType is a published size of a photo.
+	PhotoSizeType = state.PhotoSizeType
+)
+
+// ErrNotExist is returned for albums and photos which aren't part of the state.
+var ErrNotExist = errors.New("does not exist")
+
+// Workspace is a lake along with its state. Operations change the State in place, so save it
+// with Save once they are done.
+type Workspace struct {
+	Client Client
+	State  State
+
+	// Concurrency is how many photos are processed at once. It defaults to the number of CPUs.
+	Concurrency int
+	// Debugf receives debug output when it is set.
+	Debugf func(format string, v ...interface{})
+	// OnEvent is told about every file which was uploaded, removed or downloaded. It may be
+	// called from several goroutines at once.
+	OnEvent func(Event)
+}
+
+// EventKind is what happened to a file.
+type EventKind string
+
+// Kinds of events.
+const (
+	EventUploaded   EventKind = "uploaded"
+	EventRemoved    EventKind = "removed"
+	EventDownloaded EventKind = "downloaded"
+)
+
+// Event reports the progress of an operation.
+type Event struct {
+	Kind  EventKind
+	Album string
+	Photo Photo
+	Size  PhotoSizeType
+	// File is the name of the file in the lake.
+	File string
+}
+
+// RenderOptions choose how the html files are regenerated after an operation.
+type RenderOptions struct {
+	// TplDir is a directory of themes which override the installed and bundled themes.
+	TplDir string
+	// Theme overrides the themes of the workspace and album when it isn't empty.
+	Theme string
+	// Force uploads every html file instead of only the ones which changed.
+	Force bool
+}
+
+// Open finds the state of the lake the client is configured for. The local copy of the state
+// is preferred, then the remote state. A new lake is created when neither exists.
+func Open(ctx context.Context, client Client) (*Workspace, error) {
+	w := &Workspace{Client: client}
+	local, err := state.FetchLocal()
+	if err == nil && local.ID != "" {
+		client.SetLakeName(local.LakeName)
+		w.State = local
+		return w, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	lakeName, err := client.FindLakeName(ctx)
+	if err != nil && !errors.Is(err, provider.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		client.SetLakeName(lakeName)
+		remote, err := state.FetchRemote(ctx, client)
+		if err != nil && !errors.Is(err, provider.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil && remote.ID != "" {
+			// A dry run leaves the local copy alone like every other file.
+			if _, dryRun := client.(*DryRunClient); !dryRun {
+				if err := remote.SaveLocal(); err != nil {
+					return nil, err
+				}
+			}
+			w.State = remote
+			return w, nil
+		}
+	}
+	w.State = state.New()
+	client.SetLakeName(w.State.LakeName)
+	if err := client.CreateLake(ctx); err != nil {
+		return nil, fmt.Errorf("could not create lake: %w", err)
+	}
+	return w, w.Save(ctx)
+}
+
+// Save stores the state locally and in the lake. Only the upload is recorded with a
+// DryRunClient.
+func (w *Workspace) Save(ctx context.Context) error {
+	if _, ok := w.Client.(*DryRunClient); ok {
+		return w.State.SaveRemote(ctx, w.Client)
+	}
+	if err := w.State.SaveLocal(); err != nil {
+		return err
+	}
+	return w.State.SaveRemote(ctx, w.Client)
+}
+
+// Album finds an album of the workspace.
+func (w *Workspace) Album(id string) (Album, error) {
+	a := w.State.GetAlbum(id)
+	if a == nil {
+		return Album{}, fmt.Errorf("album %s %w", id, ErrNotExist)
+	}
+	return *a, nil
+}
+
+func (w *Workspace) concurrency() int {
+	if w.Concurrency > 0 {
+		return w.Concurrency
+	}
+	return runtime.NumCPU()
+}
+
+func (w *Workspace) debugf(format string, v ...interface{}) {
+	if w.Debugf != nil {
+		w.Debugf(format, v...)
+	}
+}
+
+func (w *Workspace) emit(e Event) {
+	if w.OnEvent != nil {
+		w.OnEvent(e)
+	}
+}
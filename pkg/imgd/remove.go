@@ -0,0 +1,125 @@
+package imgd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"golang.org/x/sync/semaphore"
+)
+
+// removeJob is a size of a photo which will be removed.
+type removeJob struct {
+	size  state.PhotoSizeType
+	photo state.Photo
+}
+
+func removeJobs(st state.State, album state.Album) []removeJob {
+	jobs := make([]removeJob, 0)
+	for _, hash := range album.Photos {
+		photo := st.GetPhoto(hash)
+		if photo != nil {
+			for _, size := range state.GetPhotoSizeTypes() {
+				jobs = append(jobs, removeJob{
+					size:  size,
+					photo: *photo,
+				})
+			}
+		}
+	}
+	return jobs
+}
+
+// RemoveAlbum removes the photos of an album from the lake along with its html files, then
+// the album itself, and regenerates the index page.
+func (w *Workspace) RemoveAlbum(ctx context.Context, albumID string, opts RenderOptions) []error {
+	album, err := w.Album(albumID)
+	if err != nil {
+		return []error{err}
+	}
+	client, st, jobs := w.Client, w.State, removeJobs(w.State, album)
+	var mu sync.Mutex
+	errors := make([]error, 0)
+	maxWorkers := 20
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+
+	for _, job := range jobs {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			w.debugf("Failed to acquire semaphore: %v", err)
+			break
+		}
+		go func(j removeJob) {
+			defer sem.Release(1)
+			if err := client.RemoveFile(ctx, j.photo.RawFilename(j.size)); err != nil && err != provider.ErrNotExist {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			if j.size == state.PhotoSizeTypeOriginal {
+				for _, size := range album.PhotoPageSizes() {
+					err := client.RemoveFile(ctx, j.photo.PublicSlug(album, size))
+					mu.Lock()
+					if err != nil && err != provider.ErrNotExist {
+						errors = append(errors, err)
+					}
+					st = st.RemoveRendered(j.photo.PublicSlug(album, size))
+					mu.Unlock()
+				}
+			}
+			if j.size != state.PhotoSizeTypeOriginal && album.Watermarked[j.photo.Hash] != "" {
+				if err := client.RemoveFile(ctx, j.photo.WatermarkedFilename(album, j.size)); err != nil && err != provider.ErrNotExist {
+					mu.Lock()
+					errors = append(errors, err)
+					mu.Unlock()
+				}
+			}
+			if j.size == state.PhotoSizeTypeOriginal && j.photo.PublicOriginal != "" {
+				if err := client.RemoveFile(ctx, j.photo.PublicOriginal); err != nil && err != provider.ErrNotExist {
+					mu.Lock()
+					errors = append(errors, err)
+					mu.Unlock()
+				}
+			}
+			w.emit(Event{Kind: EventRemoved, Album: album.ID, Photo: j.photo, Size: j.size, File: j.photo.RawFilename(j.size)})
+			if j.size == state.PhotoSizeTypeOriginal {
+				mu.Lock()
+				st = st.RemovePhotoFromAlbum(album, j.photo)
+				st = st.RemovePhotoSafe(j.photo)
+				mu.Unlock()
+			}
+		}(job)
+	}
+	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
+		w.debugf("Failed to acquire semaphore: %v", err)
+	}
+	if st, err = gallery.RemoveAlbumPages(ctx, client, st, album, 2); err != nil {
+		errors = append(errors, err)
+	}
+	// The first page is removed even when it was rendered before the state recorded pages.
+	for _, slug := range []string{album.PageSlug(1), album.FeedSlug(), album.CatalogueSlug()} {
+		if err := client.RemoveFile(ctx, slug); err != nil && err != provider.ErrNotExist {
+			errors = append(errors, err)
+		}
+		st = st.RemoveRendered(slug)
+	}
+	// Regenerate the index file.
+	if st, err = gallery.CreateIndexTemplate(ctx, gallery.CreateIndexOptions{
+		ThemeName: opts.Theme,
+		TplDir:    opts.TplDir,
+		Client:    client,
+		St:        st,
+	}); err != nil {
+		errors = append(errors, err)
+	}
+	if a := st.GetAlbum(album.ID); a != nil && len(a.Photos) == 0 {
+		st = st.RemoveAlbum(*a)
+	} else if len(errors) == 0 {
+		errors = append(errors, fmt.Errorf("could not remove every photo of album %s", album.ID))
+	}
+	w.State = st
+	return errors
+}
@@ -0,0 +1,559 @@
+package imgd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/psaia/imgd/internal/gallery"
+	"github.com/psaia/imgd/internal/media"
+	"github.com/psaia/imgd/internal/provider"
+	"github.com/psaia/imgd/internal/state"
+	"golang.org/x/sync/semaphore"
+)
+
+// syncJob represents a media item which will be added or removed.
+type syncJob struct {
+	srcFilePath string
+	size        state.PhotoSizeType
+	photo       state.Photo
+	dstFilePath string
+	remove      bool
+	republish   bool
+	watermark   bool
+	// stale removes a watermarked size the watermark no longer applies to.
+	stale bool
+}
+
+// uploadedFilename is the name a created job is uploaded as.
+func (j syncJob) uploadedFilename(a Album) string {
+	if j.watermark {
+		return j.photo.WatermarkedFilename(a, j.size)
+	}
+	return j.photo.RawFilename(j.size)
+}
+
+// ChangeKind is how a sync changes a photo.
+type ChangeKind string
+
+// Kinds of changes.
+const (
+	// ChangeAdd uploads a new photo.
+	ChangeAdd ChangeKind = "add"
+	// ChangeRepublish uploads a photo again since the privacy policy of the album changed.
+	ChangeRepublish ChangeKind = "republish"
+	// ChangeWatermark uploads the watermarked sizes of a photo.
+	ChangeWatermark ChangeKind = "watermark"
+	// ChangeRemove removes a photo which is no longer part of the album.
+	ChangeRemove ChangeKind = "remove"
+	// ChangeRemoveWatermark removes the watermarked sizes of a photo.
+	ChangeRemoveWatermark ChangeKind = "remove-watermark"
+)
+
+// Change is what a sync does to a photo.
+type Change struct {
+	Kind  ChangeKind
+	Photo Photo
+}
+
+// SyncPlan is what a sync of an album uploads and removes. Review it with Changes before
+// running it with SyncAlbum.
+type SyncPlan struct {
+	Album Album
+	// Duplicates are the added photos which nearly match another photo of the workspace or
+	// another added photo. Every pair is listed once.
+	Duplicates []Duplicate
+	creating   []syncJob
+	removing   []syncJob
+}
+
+// Duplicate is an added photo which nearly matches another photo, see
+// state.DefaultDuplicateThreshold.
+type Duplicate struct {
+	Photo Photo
+	Other Photo
+}
+
+// Empty is true when the sync only regenerates the html files.
+func (p SyncPlan) Empty() bool {
+	return len(p.creating) == 0 && len(p.removing) == 0
+}
+
+// Changes lists what the sync does to each photo.
+func (p SyncPlan) Changes() []Change {
+	changes := make([]Change, 0)
+	watermarks := make(map[string]bool)
+	for _, job := range p.creating {
+		if job.watermark && !watermarks[job.photo.Hash] {
+			watermarks[job.photo.Hash] = true
+			changes = append(changes, Change{Kind: ChangeWatermark, Photo: job.photo})
+		} else if job.size == state.PhotoSizeTypeOriginal && job.republish {
+			changes = append(changes, Change{Kind: ChangeRepublish, Photo: job.photo})
+		} else if job.size == state.PhotoSizeTypeOriginal && !job.watermark {
+			changes = append(changes, Change{Kind: ChangeAdd, Photo: job.photo})
+		}
+	}
+	for _, job := range p.removing {
+		if job.watermark && !watermarks[job.photo.Hash] {
+			watermarks[job.photo.Hash] = true
+			changes = append(changes, Change{Kind: ChangeRemoveWatermark, Photo: job.photo})
+		} else if job.size == state.PhotoSizeTypeOriginal && !job.watermark {
+			changes = append(changes, Change{Kind: ChangeRemove, Photo: job.photo})
+		}
+	}
+	return changes
+}
+
+// PlanSync compares the photos of an album with the photo files of a directory. Photos which
+// are missing from the files are removed.
+func (w *Workspace) PlanSync(albumID string, files []string) (SyncPlan, error) {
+	a, err := w.Album(albumID)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	creating, removing, err := syncPrep(files, w.State, a)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	plan := SyncPlan{Album: a, creating: creating, removing: removing}
+	w.analyzeAdded(plan)
+	plan.Duplicates = duplicates(w.State, plan)
+	return plan, nil
+}
+
+// analyzeAdded analyzes the added photos up front so near duplicates are known before the
+// sync runs. Photos which fail are analyzed again, and fail, while syncing.
+func (w *Workspace) analyzeAdded(plan SyncPlan) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	analyzed := make(map[string]Photo)
+	limit := make(chan struct{}, w.concurrency())
+	for _, change := range plan.Changes() {
+		if change.Kind != ChangeAdd || change.Photo.Analyzed() {
+			continue
+		}
+		var src string
+		for _, job := range plan.creating {
+			if job.photo.Hash == change.Photo.Hash {
+				src = job.srcFilePath
+				break
+			}
+		}
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(photo Photo, src string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			raw, err := ioutil.ReadFile(src)
+			if err == nil {
+				err = AnalyzeOriginal(raw, &photo)
+			}
+			if err != nil {
+				w.debugf("Error occurred while analyzing src file (%s): %v", src, err)
+				return
+			}
+			mu.Lock()
+			analyzed[photo.Hash] = photo
+			mu.Unlock()
+		}(change.Photo, src)
+	}
+	wg.Wait()
+	for idx, job := range plan.creating {
+		if photo, ok := analyzed[job.photo.Hash]; ok {
+			plan.creating[idx].photo = photo
+		}
+	}
+}
+
+// duplicates finds the near duplicates among the added photos and the photos of the
+// workspace.
+func duplicates(st state.State, plan SyncPlan) []Duplicate {
+	found := make([]Duplicate, 0)
+	added := make([]Photo, 0)
+	for _, change := range plan.Changes() {
+		if change.Kind == ChangeAdd {
+			added = append(added, change.Photo)
+		}
+	}
+	for i, photo := range added {
+		for _, other := range st.SimilarPhotos(photo, state.DefaultDuplicateThreshold) {
+			found = append(found, Duplicate{Photo: photo, Other: other})
+		}
+		h, err := media.ParsePerceptualHash(photo.PerceptualHash)
+		if err != nil {
+			continue
+		}
+		for _, other := range added[i+1:] {
+			oh, err := media.ParsePerceptualHash(other.PerceptualHash)
+			if err == nil && other.Hash != photo.Hash && h.Distance(oh) <= state.DefaultDuplicateThreshold {
+				found = append(found, Duplicate{Photo: photo, Other: other})
+			}
+		}
+	}
+	return found
+}
+
+// PlanAddPhotos is PlanSync without removing the photos which are missing from the files.
+func (w *Workspace) PlanAddPhotos(albumID string, files []string) (SyncPlan, error) {
+	plan, err := w.PlanSync(albumID, files)
+	plan.removing = nil
+	return plan, err
+}
+
+// PlanRemovePhotos removes photos from an album.
+func (w *Workspace) PlanRemovePhotos(albumID string, hashes ...string) (SyncPlan, error) {
+	a, err := w.Album(albumID)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	plan := SyncPlan{Album: a}
+	for _, hash := range hashes {
+		photo := w.State.GetPhoto(hash)
+		if photo == nil || !a.HasPhoto(hash) {
+			return SyncPlan{}, fmt.Errorf("photo %s %w in album", hash, ErrNotExist)
+		}
+		for _, size := range state.GetPhotoSizeTypes() {
+			plan.removing = append(plan.removing, syncJob{photo: *photo, remove: true, size: size})
+		}
+	}
+	return plan, nil
+}
+
+func (w *Workspace) syncResizeTask(ctx context.Context, job *syncJob, wm *media.WatermarkOptions) error {
+	if job.size != state.PhotoSizeTypeOriginal {
+		dir, err := ioutil.TempDir("", "imgd-imgcache")
+		if err != nil {
+			return err
+		}
+		w.debugf("%s: Resizing started", job.photo.RawFilename(job.size))
+		job.dstFilePath = fmt.Sprintf("%s/%s", dir, job.photo.RawFilename(job.size))
+		if !job.watermark {
+			wm = nil
+		}
+		raw, err := ioutil.ReadFile(job.srcFilePath)
+		if err != nil {
+			return err
+		}
+		b, err := RenderDerivative(raw, job.photo, job.size, wm)
+		if err != nil {
+			w.debugf("Error occurred while resizing src file (%s): %v", job.srcFilePath, err)
+			return err
+		}
+		if err = ioutil.WriteFile(job.dstFilePath, b, 0644); err != nil {
+			w.debugf("Error occurred while saving resized photo (%s): %v", job.dstFilePath, err)
+			return err
+		}
+		w.debugf("%s: Resizing completed", job.photo.RawFilename(job.size))
+	} else {
+		// No need to ressize for original photos. Just point the dst to the src.
+		job.dstFilePath = job.srcFilePath
+	}
+	return nil
+}
+
+func (w *Workspace) syncAnalyzeTask(ctx context.Context, job *syncJob) error {
+	if job.size != state.PhotoSizeTypeOriginal || job.watermark || job.photo.Analyzed() {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(job.srcFilePath)
+	if err != nil {
+		return err
+	}
+	if err := AnalyzeOriginal(raw, &job.photo); err != nil {
+		w.debugf("Error occurred while analyzing src file (%s): %v", job.srcFilePath, err)
+		return err
+	}
+	w.debugf("%s: Analyzed", job.photo.Hash)
+	return nil
+}
+
+func (w *Workspace) syncUploadTask(ctx context.Context, album Album, job *syncJob) error {
+	if job.size == state.PhotoSizeTypeOriginal && job.photo.PrivateOriginal {
+		return w.syncUploadPrivateTask(ctx, job)
+	}
+	filename := job.photo.RawFilename(job.size)
+	if job.watermark {
+		filename = job.photo.WatermarkedFilename(album, job.size)
+	}
+	r, err := os.Open(job.dstFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := r.Close(); err != nil {
+			w.debugf("Encountered error while trying to close file: %v", err)
+		}
+	}()
+	w.debugf("%s: Uploading started", filename)
+	_, err = w.Client.UploadFile(ctx, filename, r)
+	if err != nil {
+		w.debugf("Error occurred while uploading to storage: %v", err)
+		return err
+	}
+	w.debugf("%s: Uploading completed", filename)
+	if job.size == state.PhotoSizeTypeOriginal && job.photo.PublicOriginal != "" {
+		// The original used to be private so its sanitized copy is now redundant.
+		if err := w.Client.RemoveFile(ctx, job.photo.PublicOriginal); err != nil && err != provider.ErrNotExist {
+			return err
+		}
+		job.photo.PublicOriginal = ""
+	}
+	return nil
+}
+
+// syncUploadPrivateTask uploads the true original privately and publishes a sanitized copy
+// in its place. Formats which can't be sanitized fall back to linking the large derivative.
+func (w *Workspace) syncUploadPrivateTask(ctx context.Context, job *syncJob) error {
+	b, err := ioutil.ReadFile(job.dstFilePath)
+	if err != nil {
+		return err
+	}
+	w.debugf("%s: Uploading privately", job.photo.RawFilename(job.size))
+	if _, err := w.Client.UploadPrivateFile(ctx, job.photo.RawFilename(job.size), bytes.NewReader(b)); err != nil {
+		w.debugf("Error occurred while uploading to storage: %v", err)
+		return err
+	}
+	sanitized, err := media.Sanitize(b, job.photo.Privacy.StripMode())
+	if errors.Is(err, media.ErrUnsupportedFormat) {
+		w.debugf("%s: Can not sanitize %s files, the large version will be linked instead", job.photo.Hash, job.photo.Extension)
+		job.photo.PublicOriginal = ""
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := w.Client.UploadFile(ctx, job.photo.SanitizedFilename(), bytes.NewReader(sanitized)); err != nil {
+		w.debugf("Error occurred while uploading sanitized original to storage: %v", err)
+		return err
+	}
+	job.photo.PublicOriginal = job.photo.SanitizedFilename()
+	w.debugf("%s: Uploading completed", job.photo.RawFilename(job.size))
+	return nil
+}
+
+func (w *Workspace) syncCleanupTask(ctx context.Context, job *syncJob) error {
+	if job.size != state.PhotoSizeTypeOriginal { // Only remove an image if it has a custom w/h. Otherwise, it's the original.
+		w.debugf("%s: Removing", job.dstFilePath)
+		if err := os.RemoveAll(path.Dir(job.dstFilePath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncPrep(files []string, st state.State, a state.Album) ([]syncJob, []syncJob, error) {
+	forRemoval := make([]syncJob, 0)
+	forCreation := make([]syncJob, 0)
+	preExistingHash := make(map[string]state.Photo)
+
+	for _, file := range files {
+		photo, exists, err := st.MarshalPhotoFromSrc(file)
+		if err != nil {
+			return forCreation, forRemoval, err
+		}
+		preExistingHash[photo.Hash] = photo
+		if !exists || st.NeedsRepublish(photo, a) {
+			photo.Privacy, photo.PrivateOriginal = st.SharedPolicy(photo, a)
+			for _, size := range state.GetPhotoSizeTypes() {
+				forCreation = append(forCreation, syncJob{
+					srcFilePath: file,
+					size:        size,
+					photo:       photo,
+					republish:   exists,
+				})
+			}
+		}
+		if a.NeedsWatermark(photo) {
+			for _, size := range state.GetPhotoSizeTypes() {
+				if a.Watermark.Applies(size) {
+					forCreation = append(forCreation, syncJob{
+						srcFilePath: file,
+						size:        size,
+						photo:       photo,
+						watermark:   true,
+					})
+				}
+			}
+		}
+	}
+	// The watermark was removed or no longer applies to some sizes, so these watermarked
+	// copies are no longer needed.
+	if a.Watermark != nil {
+		for _, size := range a.StaleWatermarkSizes() {
+			for hash := range a.Watermarked {
+				if photo := st.GetPhoto(hash); photo != nil {
+					forRemoval = append(forRemoval, syncJob{
+						photo:     *photo,
+						remove:    true,
+						size:      size,
+						watermark: true,
+						stale:     true,
+					})
+				}
+			}
+		}
+	} else {
+		for hash := range a.Watermarked {
+			if photo := st.GetPhoto(hash); photo != nil {
+				for _, size := range state.GetPhotoSizeTypes()[1:] {
+					forRemoval = append(forRemoval, syncJob{
+						photo:     *photo,
+						remove:    true,
+						size:      size,
+						watermark: true,
+					})
+				}
+			}
+		}
+	}
+	for _, hash := range a.Photos {
+		if _, exists := preExistingHash[hash]; !exists {
+			for _, size := range state.GetPhotoSizeTypes() {
+				photo := st.GetPhoto(hash)
+				forRemoval = append(forRemoval, syncJob{
+					photo:  *photo,
+					remove: true,
+					size:   size,
+				})
+			}
+		}
+	}
+	return forCreation, forRemoval, nil
+}
+
+// SyncAlbum uploads and removes the photos of a plan and regenerates the html files of the
+// album. The state is updated with every photo which succeeded.
+func (w *Workspace) SyncAlbum(ctx context.Context, plan SyncPlan, opts RenderOptions) []error {
+	client, album, st := w.Client, plan.Album, w.State
+	forCreation, forRemoval := plan.creating, plan.removing
+	defer func() { w.State = st }()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errors := make([]error, 0)
+	errc := make(chan error)
+	maxWorkers := w.concurrency()
+	sem := semaphore.NewWeighted(int64(maxWorkers))
+	w.debugf("Sync concurrency set to %d", maxWorkers)
+
+	wm, err := LoadWatermark(ctx, client, album.Watermark)
+	if err != nil {
+		return []error{err}
+	}
+
+	wg.Add(1) // Resolves when errors chan is closed.
+
+	go func() {
+		defer wg.Done()
+		for err := range errc {
+			mu.Lock()
+			errors = append(errors, err)
+			mu.Unlock()
+		}
+	}()
+
+	for _, j := range forCreation {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			w.debugf("Failed to acquire semaphore: %v", err)
+			break
+		}
+		go func(j syncJob) {
+			defer sem.Release(1)
+			job := &j
+			if err := w.syncResizeTask(ctx, job, wm); err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			if err := w.syncAnalyzeTask(ctx, job); err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+				return
+			}
+			if err := w.syncUploadTask(ctx, album, job); err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+			} else {
+				w.emit(Event{Kind: EventUploaded, Album: album.ID, Photo: job.photo, Size: job.size, File: job.uploadedFilename(album)})
+				if job.watermark {
+					mu.Lock()
+					st = st.SetWatermarked(album, job.photo, album.Watermark.Signature())
+					mu.Unlock()
+				} else if job.size == state.PhotoSizeTypeOriginal {
+					// Only the original size photos need to be persisted.
+					mu.Lock()
+					st = st.PersistPhoto(job.photo)
+					st = st.AddPhotoToAlbum(album, job.photo)
+					mu.Unlock()
+				}
+			}
+			if err := w.syncCleanupTask(ctx, job); err != nil {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+			}
+		}(j)
+	}
+	if err := sem.Acquire(ctx, int64(maxWorkers)); err != nil {
+		w.debugf("Failed to acquire semaphore: %v", err)
+	}
+	watermarksRemoved := true
+	for _, job := range forRemoval {
+		if job.watermark || (album.Watermarked[job.photo.Hash] != "" && job.size != state.PhotoSizeTypeOriginal) {
+			if err := client.RemoveFile(ctx, job.photo.WatermarkedFilename(album, job.size)); err != nil && err != provider.ErrNotExist {
+				errors = append(errors, fmt.Errorf("Encountered error while removing watermarked photo from storage: %v", err))
+				watermarksRemoved = false
+			}
+		}
+		if job.watermark {
+			if !job.stale {
+				st = st.SetWatermarked(album, job.photo, "")
+			}
+			continue
+		}
+		if err := client.RemoveFile(ctx, job.photo.RawFilename(job.size)); err != nil {
+			errors = append(errors, fmt.Errorf("Encountered error while removing photo from storage: %v", err))
+		}
+		if job.size == state.PhotoSizeTypeOriginal && job.photo.PublicOriginal != "" && st.Occurrences(job.photo) <= 1 {
+			if err := client.RemoveFile(ctx, job.photo.PublicOriginal); err != nil {
+				errors = append(errors, fmt.Errorf("Encountered error while removing sanitized photo from storage: %v", err))
+			}
+		}
+		if job.size == state.PhotoSizeTypeOriginal {
+			for _, size := range album.PhotoPageSizes() {
+				if err := client.RemoveFile(ctx, job.photo.PublicSlug(album, size)); err != nil && err != provider.ErrNotExist {
+					errors = append(errors, fmt.Errorf("Encountered error while removing photo HTML template from storage: %v", err))
+				}
+				st = st.RemoveRendered(job.photo.PublicSlug(album, size))
+			}
+			st = st.SetWatermarked(album, job.photo, "")
+			st = st.RemovePhotoFromAlbum(album, job.photo)
+			st = st.RemovePhotoSafe(job.photo)
+		}
+		w.emit(Event{Kind: EventRemoved, Album: album.ID, Photo: job.photo, Size: job.size, File: job.photo.RawFilename(job.size)})
+		w.debugf("Removed photo: %s", job.photo.Name)
+	}
+	// Stale sizes are tried again on the next sync until every copy is gone.
+	if watermarksRemoved && album.Watermark != nil {
+		st = st.SetWatermarkedSizes(album, album.Watermark.Sizes)
+	} else if watermarksRemoved {
+		st = st.SetWatermarkedSizes(album, nil)
+	}
+	if len(forCreation) > 0 || len(forRemoval) > 0 {
+		st = st.TouchAlbum(album)
+	}
+	album = *(st.GetAlbum(album.ID))
+	st, errs := gallery.CreateTemplatesFromState(ctx, client, st, album, opts.TplDir, opts.Theme, opts.Force)
+	for _, e := range errs {
+		errc <- e
+	}
+	close(errc)
+	wg.Wait()
+	return errors
+}
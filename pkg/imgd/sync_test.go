@@ -0,0 +1,101 @@
+package imgd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/psaia/imgd/internal/state"
+)
+
+func TestPlanRemovePhotos(t *testing.T) {
+	st := state.New()
+	album := state.NewAlbum()
+	st = st.AddAlbum(album)
+	photo := state.Photo{Hash: "abc", Name: "beach"}
+	st = st.PersistPhoto(photo)
+	st = st.AddPhotoToAlbum(album, photo)
+	w := &Workspace{State: st}
+
+	plan, err := w.PlanRemovePhotos(album.ID, photo.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Empty() {
+		t.Fatalf("expected the plan to remove the photo")
+	}
+	changes := plan.Changes()
+	if len(changes) != 1 || changes[0].Kind != ChangeRemove || changes[0].Photo.Hash != photo.Hash {
+		t.Fatalf("expected a single removal of %s. got %+v", photo.Hash, changes)
+	}
+	if _, err := w.PlanRemovePhotos(album.ID, "missing"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for a photo outside the album. got %v", err)
+	}
+	if _, err := w.PlanSync("missing", nil); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for an unknown album. got %v", err)
+	}
+}
+
+func TestPlanAddPhotosKeepsPhotos(t *testing.T) {
+	st := state.New()
+	album := state.NewAlbum()
+	st = st.AddAlbum(album)
+	photo := state.Photo{Hash: "abc", Name: "beach"}
+	st = st.PersistPhoto(photo)
+	st = st.AddPhotoToAlbum(album, photo)
+	w := &Workspace{State: st}
+
+	if plan, err := w.PlanSync(album.ID, nil); err != nil || len(plan.Changes()) != 1 {
+		t.Fatalf("expected sync to remove the missing photo. got %v %v", plan.Changes(), err)
+	}
+	plan, err := w.PlanAddPhotos(album.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("expected adding no photos to keep the album as is. got %+v", plan.Changes())
+	}
+}
+
+func TestSyncPrepStaleWatermarks(t *testing.T) {
+	st := state.New()
+	album := state.NewAlbum()
+	album.Watermark = &state.Watermark{Text: "imgd", Sizes: []state.PhotoSizeType{state.PhotoSizeTypeLarge}}
+	album.WatermarkedSizes = []state.PhotoSizeType{state.PhotoSizeTypeMedium, state.PhotoSizeTypeLarge}
+	photo := state.Photo{Hash: "abc", Name: "beach"}
+	album.Watermarked = map[string]string{photo.Hash: album.Watermark.Signature()}
+	st = st.AddAlbum(album)
+	st = st.PersistPhoto(photo)
+
+	_, removing, err := syncPrep(nil, st, album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removing) != 1 || !removing[0].stale || removing[0].size != state.PhotoSizeTypeMedium {
+		t.Fatalf("expected only the medium watermarked copy to be removed. got %+v", removing)
+	}
+}
+
+func TestDuplicatesListsPairsOnce(t *testing.T) {
+	st := state.New()
+	album := state.NewAlbum()
+	st = st.AddAlbum(album)
+	existing := state.Photo{Hash: "old", Name: "old", PerceptualHash: "00000000000000ff"}
+	st = st.PersistPhoto(existing)
+	plan := SyncPlan{Album: album}
+	for _, p := range []state.Photo{
+		{Hash: "a", Name: "a", PerceptualHash: "0000000000000000"},
+		{Hash: "b", Name: "b", PerceptualHash: "0000000000000001"},
+		{Hash: "c", Name: "c", PerceptualHash: "ffffffffffffffff"},
+	} {
+		plan.creating = append(plan.creating, syncJob{photo: p, size: state.PhotoSizeTypeOriginal})
+	}
+
+	found := duplicates(st, plan)
+	pairs := make(map[string]bool)
+	for _, d := range found {
+		pairs[d.Photo.Hash+"-"+d.Other.Hash] = true
+	}
+	if len(found) != 3 || !pairs["a-old"] || !pairs["b-old"] || !pairs["a-b"] {
+		t.Fatalf("expected a and b to match each other once and the existing photo. got %+v", found)
+	}
+}
@@ -0,0 +1,16 @@
+document.addEventListener("DOMContentLoaded", function() {
+    var p = document.getElementsByClassName("photo")[0];
+    p.addEventListener("mouseenter", function() {
+        document.body.classList.add("on-photo");
+    });
+    p.addEventListener("mouseleave", function() {
+        document.body.classList.remove("on-photo");
+    });
+    document.addEventListener("keydown", function(e) {
+        var rel = {ArrowLeft: "prev", ArrowRight: "next"}[e.key];
+        var link = rel && document.querySelector("a[rel=" + rel + "]");
+        if (link) {
+            window.location = link.href;
+        }
+    });
+});
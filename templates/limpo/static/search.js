@@ -0,0 +1,64 @@
+document.addEventListener("DOMContentLoaded", function() {
+    var results = document.getElementsByClassName("results")[0];
+    var summary = document.getElementsByClassName("summary")[0];
+    var input = document.querySelector(".search input");
+    var limit = 200;
+    var index;
+
+    // Every term has to be found in the text of a photo or its album.
+    function search(query) {
+        var terms = query.toLowerCase().split(/\s+/).filter(Boolean);
+        results.innerHTML = "";
+        if (!terms.length) {
+            summary.textContent = "";
+            return;
+        }
+        var matches = index.photos.filter(function(p) {
+            return terms.every(function(term) {
+                return p.text.indexOf(term) !== -1;
+            });
+        });
+        summary.textContent = matches.length + (matches.length === 1 ? " photo" : " photos");
+        matches.slice(0, limit).forEach(function(p) {
+            var album = index.albums[p.a];
+            var li = document.createElement("li");
+            var a = document.createElement("a");
+            var img = document.createElement("img");
+            var name = document.createElement("span");
+            var count = document.createElement("span");
+            a.href = p.u;
+            img.src = p.i;
+            img.alt = p.c || p.n;
+            img.loading = "lazy";
+            name.className = "name";
+            name.textContent = p.c || p.n;
+            count.className = "count";
+            count.textContent = album.name + (p.d ? " · " + p.d : "");
+            a.appendChild(img);
+            a.appendChild(name);
+            a.appendChild(count);
+            li.appendChild(a);
+            results.appendChild(li);
+        });
+    }
+
+    var query = new URLSearchParams(window.location.search).get("q") || "";
+    input.value = query;
+    input.addEventListener("input", function() {
+        if (index) {
+            search(input.value);
+            history.replaceState(null, "", "?q=" + encodeURIComponent(input.value));
+        }
+    });
+
+    fetch(results.getAttribute("data-index")).then(function(res) {
+        return res.json();
+    }).then(function(data) {
+        data.photos.forEach(function(p) {
+            var album = data.albums[p.a];
+            p.text = [p.n, p.c, (p.t || []).join(" "), p.m, p.d, album.name, album.description].join(" ").toLowerCase();
+        });
+        index = data;
+        search(input.value);
+    });
+});
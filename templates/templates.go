@@ -0,0 +1,12 @@
+// Package templates bundles the default themes into the binary so imgd works from any directory.
+package templates
+
+import "embed"
+
+// DefaultTheme is used when no theme is chosen.
+const DefaultTheme = "limpo"
+
+// FS contains every bundled theme, each in a directory of its own.
+//
+//go:embed limpo
+var FS embed.FS